@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// ChangeKind is the kind of a filesystem change, numbered like in the docker API
+type ChangeKind int
+
+const (
+	// ChangeModify is a path which exists in the image and was changed
+	ChangeModify ChangeKind = iota
+	// ChangeAdd is a path which does not exist in the image
+	ChangeAdd
+	// ChangeDelete is a path of the image which was deleted
+	ChangeDelete
+)
+
+// String returns the letter docker diff prints for the kind
+func (kind ChangeKind) String() string {
+	switch kind {
+	case ChangeModify:
+		return "C"
+	case ChangeAdd:
+		return "A"
+	case ChangeDelete:
+		return "D"
+	default:
+		return "?"
+	}
+}
+
+/**
+ * @Description: Change is a changed path of a container, absolute inside the container
+ */
+type Change struct {
+	Path string     `json:"Path"`
+	Kind ChangeKind `json:"Kind"`
+}
+
+/**
+ * @Description: OverlayChanges lists the changes an overlayfs upper dir makes to its lower
+ *	layers: whiteouts are deletions, and an opaque directory deletes everything of the
+ *	lower layers below it which it does not contain itself
+ * @param lowerDirs layers of the image, top-most first
+ * @param upperDir upper dir of the container
+ * @return changes sorted by path, error
+ */
+func OverlayChanges(lowerDirs []string, upperDir string) ([]Change, error) {
+	var changes []Change
+	err := filepath.WalkDir(upperDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upperDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if isOverlayWhiteout(fi) {
+			if lowerExists(lowerDirs, rel) {
+				changes = append(changes, Change{Path: "/" + rel, Kind: ChangeDelete})
+			}
+			return nil
+		}
+		if !lowerExists(lowerDirs, rel) {
+			changes = append(changes, Change{Path: "/" + rel, Kind: ChangeAdd})
+			return nil
+		}
+		changes = append(changes, Change{Path: "/" + rel, Kind: ChangeModify})
+
+		if fi.IsDir() && isOpaqueDir(path) {
+			deleted, err := hiddenChildren(lowerDirs, upperDir, rel)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, deleted...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// hiddenChildren lists the children of a directory in the lower layers which an opaque upper dir hides
+func hiddenChildren(lowerDirs []string, upperDir string, rel string) ([]Change, error) {
+	seen := make(map[string]bool)
+	var changes []Change
+	for _, dir := range lowerDirs {
+		if fi, err := layerLstat(dir, rel); err != nil || !fi.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(dir, rel))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			child := filepath.Join(rel, entry.Name())
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			if _, err := os.Lstat(filepath.Join(upperDir, child)); err == nil {
+				continue
+			}
+			if lowerExists(lowerDirs, child) {
+				changes = append(changes, Change{Path: "/" + child, Kind: ChangeDelete})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// lowerExists reports whether rel is visible in the stack of lower layers
+func lowerExists(lowerDirs []string, rel string) bool {
+	for _, dir := range lowerDirs {
+		if fi, err := layerLstat(dir, rel); err == nil {
+			return !isOverlayWhiteout(fi)
+		}
+		if hidesBelow(dir, rel) {
+			return false
+		}
+	}
+	return false
+}
+
+// hidesBelow reports whether a layer hides rel in the layers below it, by a whiteout,
+// an opaque directory or a file in place of one of the parent directories
+func hidesBelow(dir string, rel string) bool {
+	for parent := filepath.Dir(rel); parent != "."; parent = filepath.Dir(parent) {
+		fi, err := layerLstat(dir, parent)
+		if err != nil {
+			continue
+		}
+		if !fi.IsDir() || isOpaqueDir(filepath.Join(dir, parent)) {
+			return true
+		}
+	}
+	return false
+}
+
+// layerLstat stats rel in a layer like overlayfs looks it up: no symlink is followed, not even
+// in the parent directories, and a path below a file or symlink does not exist in the layer
+func layerLstat(dir string, rel string) (os.FileInfo, error) {
+	current := dir
+	parts := strings.Split(filepath.Clean(rel), string(filepath.Separator))
+	for i, part := range parts {
+		current = filepath.Join(current, part)
+		fi, err := os.Lstat(current)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(parts)-1 {
+			return fi, nil
+		}
+		if !fi.IsDir() {
+			return nil, &os.PathError{Op: "lstat", Path: filepath.Join(dir, rel), Err: syscall.ENOTDIR}
+		}
+	}
+	return nil, &os.PathError{Op: "lstat", Path: filepath.Join(dir, rel), Err: syscall.ENOENT}
+}
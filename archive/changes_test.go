@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// layerFixture creates the entries of a layer below dir: a trailing / makes a directory,
+// "->" a symlink, "wh" an overlayfs whiteout, "opaque/" an opaque directory, anything else a file
+func layerFixture(t *testing.T, dir string, entries map[string]string) {
+	t.Helper()
+	for name, kind := range entries {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		switch {
+		case kind == "/":
+			err = os.MkdirAll(path, 0755)
+		case kind == "opaque/":
+			if err = os.MkdirAll(path, 0755); err == nil {
+				if err = unix.Lsetxattr(path, OverlayOpaqueXattr, []byte("y"), 0); err != nil {
+					t.Skipf("can not set %s: %v", OverlayOpaqueXattr, err)
+				}
+			}
+		case kind == "wh":
+			if err = unix.Mknod(path, unix.S_IFCHR, 0); err != nil {
+				t.Skipf("can not create a whiteout: %v", err)
+			}
+		case strings.HasPrefix(kind, "->"):
+			err = os.Symlink(strings.TrimPrefix(kind, "->"), path)
+		default:
+			err = os.WriteFile(path, []byte(kind), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOverlayChanges(t *testing.T) {
+	tmp := t.TempDir()
+	top, base, upper := filepath.Join(tmp, "top"), filepath.Join(tmp, "base"), filepath.Join(tmp, "upper")
+
+	layerFixture(t, base, map[string]string{
+		"etc/passwd":     "root",
+		"etc/hosts":      "localhost",
+		"gone":           "gone",
+		"old/f":          "f",
+		"lib/x":          "x",
+		"wh":             "wh",
+		"dir/below/file": "file",
+	})
+	layerFixture(t, top, map[string]string{
+		"etc/hosts": "localhost ::1",
+		// lib/x of the base layer is hidden by the link, although the link points to usr/lib/x
+		"lib":       "->usr/lib",
+		"usr/lib/x": "x",
+		"wh":        "wh",
+		// dir/below of the base layer is hidden by the file
+		"dir": "file",
+	})
+	layerFixture(t, upper, map[string]string{
+		"etc/hosts":      "127.0.0.1 localhost",
+		"etc/new":        "new",
+		"gone":           "wh",
+		"nothere":        "wh",
+		"old":            "opaque/",
+		"old/g":          "g",
+		"lib/x":          "x",
+		"wh":             "wh again",
+		"dir/below/file": "file",
+	})
+
+	changes, err := OverlayChanges([]string{top, base}, upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Path: "/dir", Kind: ChangeModify},
+		{Path: "/dir/below", Kind: ChangeAdd},
+		{Path: "/dir/below/file", Kind: ChangeAdd},
+		{Path: "/etc", Kind: ChangeModify},
+		{Path: "/etc/hosts", Kind: ChangeModify},
+		{Path: "/etc/new", Kind: ChangeAdd},
+		{Path: "/gone", Kind: ChangeDelete},
+		{Path: "/lib", Kind: ChangeModify},
+		{Path: "/lib/x", Kind: ChangeAdd},
+		{Path: "/old", Kind: ChangeModify},
+		{Path: "/old/f", Kind: ChangeDelete},
+		{Path: "/old/g", Kind: ChangeAdd},
+		{Path: "/wh", Kind: ChangeAdd},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("OverlayChanges() = %v, want %v", changes, want)
+	}
+}
@@ -0,0 +1,280 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// paxXattrPrefix prefixes the PAX records holding extended attributes
+const paxXattrPrefix = "SCHILY.xattr."
+
+/**
+ * @Description: ExtractOptions controls how an archive is extracted
+ * @param NoLchown keep the extracting user as owner instead of the owner in the archive
+ * @param OverlayWhiteouts convert OCI whiteout files into overlayfs whiteouts, for layers
+ * @param Prefix directory inside dest the entries are extracted to, symlinks are still
+ *	resolved against dest, e.g. a directory inside the root filesystem of a container
+ */
+type ExtractOptions struct {
+	NoLchown         bool
+	OverlayWhiteouts bool
+	Prefix           string
+}
+
+/**
+ * @Description: Extract unpacks a tar stream into dest. Entries are never written outside
+ *	dest: names climbing out with .. are rejected and symlinks met on the way to an
+ *	entry are resolved inside dest. Ownership is only restored when running as root.
+ * @param r uncompressed tar stream
+ * @param dest destination directory, created if needed
+ * @param opts extract options, nil for the defaults
+ * @return error
+ */
+func Extract(r io.Reader, dest string, opts *ExtractOptions) error {
+	// a copy, the caller's options stay as they are
+	options := ExtractOptions{}
+	if opts != nil {
+		options = *opts
+	}
+	opts = &options
+	if os.Geteuid() != 0 {
+		opts.NoLchown = true
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	prefix, err := CleanEntryName(opts.Prefix)
+	if err != nil {
+		return err
+	}
+
+	// Directory times are restored last, extracting their children changes them
+	var dirs []*tar.Header
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar: %v", err)
+		}
+
+		name, err := CleanEntryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if prefix != "." {
+			if name == "." {
+				// the directory extracted to exists already and keeps its attributes
+				continue
+			}
+			name = filepath.Join(prefix, name)
+			if hdr.Typeflag == tar.TypeLink {
+				if hdr.Linkname, err = CleanEntryName(hdr.Linkname); err != nil {
+					return err
+				}
+				hdr.Linkname = filepath.Join(prefix, hdr.Linkname)
+			}
+		}
+		if opts.OverlayWhiteouts && strings.HasPrefix(filepath.Base(name), WhiteoutPrefix) {
+			if err := convertWhiteout(dest, name); err != nil {
+				return fmt.Errorf("failed to convert whiteout %s: %v", hdr.Name, err)
+			}
+			continue
+		}
+		if err := extractEntry(dest, name, hdr, tr, opts); err != nil {
+			return fmt.Errorf("failed to extract %s: %v", hdr.Name, err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name = name
+			dirs = append(dirs, hdr)
+		}
+	}
+
+	for _, hdr := range dirs {
+		target, err := SecureJoin(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := setTimes(target, hdr); err != nil {
+			return fmt.Errorf("failed to set times of %s: %v", hdr.Name, err)
+		}
+	}
+	return nil
+}
+
+// extractEntry creates a single entry, its parent directories are resolved inside dest
+func extractEntry(dest string, name string, hdr *tar.Header, r io.Reader, opts *ExtractOptions) error {
+	var target string
+	if name == "." {
+		if hdr.Typeflag != tar.TypeDir {
+			return fmt.Errorf("the root entry must be a directory")
+		}
+		target = dest
+	} else {
+		parent, err := SecureJoin(dest, filepath.Dir(name))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+		target = filepath.Join(parent, filepath.Base(name))
+	}
+
+	// Replace what is in the way, but keep existing directories to merge into them
+	if fi, err := os.Lstat(target); err == nil {
+		if !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+	}
+
+	mode := uint32(hdr.FileInfo().Mode().Perm())
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(target, os.FileMode(mode)); err != nil && !os.IsExist(err) {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(mode))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, r)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		// The target is kept as it is, it is only ever followed inside the container
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		linkName, err := CleanEntryName(hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		// only the parent is resolved, a hardlink to a symlink links the symlink itself
+		parent, err := SecureJoin(dest, filepath.Dir(linkName))
+		if err != nil {
+			return err
+		}
+		source := filepath.Join(parent, filepath.Base(linkName))
+		fi, err := os.Lstat(source)
+		if err != nil {
+			return fmt.Errorf("hardlink target %s: %v", hdr.Linkname, err)
+		}
+		if fi.IsDir() {
+			return fmt.Errorf("hardlink target %s is a directory", hdr.Linkname)
+		}
+		// a hardlink shares its inode, so it has no attributes of its own
+		return os.Link(source, target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		fileType := map[byte]uint32{tar.TypeChar: unix.S_IFCHR, tar.TypeBlock: unix.S_IFBLK, tar.TypeFifo: unix.S_IFIFO}
+		dev := unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))
+		if err := unix.Mknod(target, fileType[hdr.Typeflag]|mode, int(dev)); err != nil {
+			return err
+		}
+	case tar.TypeXGlobalHeader:
+		return nil
+	default:
+		log.Warnf("Skipping %s of unsupported type %c", hdr.Name, hdr.Typeflag)
+		return nil
+	}
+
+	if !opts.NoLchown {
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if err := setXattrs(target, hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeSymlink {
+		// chown clears setuid and setgid, and the umask masks the mode at creation
+		if err := os.Chmod(target, hdr.FileInfo().Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag != tar.TypeDir {
+		return setTimes(target, hdr)
+	}
+	return nil
+}
+
+// convertWhiteout turns .wh..wh..opq into the opaque xattr of its directory
+// and .wh.<name> into a 0/0 char device named <name>, as overlayfs expects
+func convertWhiteout(dest string, name string) error {
+	dir, err := SecureJoin(dest, filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	base := filepath.Base(name)
+	if base == WhiteoutOpaqueDir {
+		return unix.Lsetxattr(dir, OverlayOpaqueXattr, []byte("y"), 0)
+	}
+	deleted := strings.TrimPrefix(base, WhiteoutPrefix)
+	if deleted == "" || deleted == "." || deleted == ".." {
+		return fmt.Errorf("invalid whiteout name")
+	}
+	target := filepath.Join(dir, deleted)
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return unix.Mknod(target, unix.S_IFCHR, 0)
+}
+
+// setXattrs restores the extended attributes recorded in the PAX records of hdr
+func setXattrs(target string, hdr *tar.Header) error {
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		attr := strings.TrimPrefix(key, paxXattrPrefix)
+		if err := unix.Lsetxattr(target, attr, []byte(value), 0); err != nil {
+			// e.g. trusted.* needs CAP_SYS_ADMIN and tmpfs has no user.*
+			if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+				log.Warnf("Ignoring xattr %s of %s: %v", attr, hdr.Name, err)
+				continue
+			}
+			return fmt.Errorf("failed to set xattr %s: %v", attr, err)
+		}
+	}
+	return nil
+}
+
+// setTimes restores the access and modification time without following symlinks
+func setTimes(target string, hdr *tar.Header) error {
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+	times := []unix.Timespec{timespec(atime), timespec(hdr.ModTime)}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, target, times, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func timespec(t time.Time) unix.Timespec {
+	if t.IsZero() {
+		return unix.Timespec{Nsec: unix.UTIME_OMIT}
+	}
+	return unix.NsecToTimespec(t.UnixNano())
+}
@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarEntry is an entry of a crafted archive, body is the content of a regular file
+type tarEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+// buildTar writes the entries into an in-memory tar stream
+func buildTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		hdr := entry.hdr
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		hdr.Size = int64(len(entry.body))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func tarFile(name string, body string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeReg}, body: body}
+}
+
+func tarDir(name string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}}
+}
+
+func tarSymlink(name string, target string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}}
+}
+
+func tarHardlink(name string, target string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target}}
+}
+
+func TestExtractRejectsEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{name: "dot dot entry", entries: []tarEntry{tarFile("../outside/evil", "evil")}},
+		{name: "nested dot dot entry", entries: []tarEntry{tarDir("a/"), tarFile("a/../../outside/evil", "evil")}},
+		{name: "escaping hardlink", entries: []tarEntry{tarHardlink("link", "../outside/secret")}},
+		{name: "absolute escaping hardlink", entries: []tarEntry{tarHardlink("link", "/../outside/secret")}},
+	}
+	for _, tt := range tests {
+		tmp := t.TempDir()
+		outside := filepath.Join(tmp, "outside")
+		if err := os.Mkdir(outside, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		// entries are wrapped with %v, only the message tells the escape apart
+		err := Extract(buildTar(t, tt.entries), filepath.Join(tmp, "dest"), nil)
+		if err == nil || !strings.Contains(err.Error(), ErrPathEscape.Error()) {
+			t.Errorf("%s: Extract() error = %v, want ErrPathEscape", tt.name, err)
+		}
+		if _, err := os.Lstat(filepath.Join(outside, "evil")); err == nil {
+			t.Errorf("%s: Extract() wrote outside dest", tt.name)
+		}
+		if _, err := os.Lstat(filepath.Join(tmp, "dest", "link")); err == nil {
+			t.Errorf("%s: Extract() created a hardlink to a file outside dest", tt.name)
+		}
+	}
+}
+
+func TestExtractConfinesSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	dest, outside := filepath.Join(tmp, "dest"), filepath.Join(tmp, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []tarEntry{
+		// absolute and climbing symlinks, then entries written through them
+		tarSymlink("abs", outside),
+		tarFile("abs/passwd", "abs"),
+		tarSymlink("up", "../../.."),
+		tarFile("up/rel", "rel"),
+		// a hardlink through a symlink may only reach files inside dest
+		tarHardlink("through", "abs/secret"),
+	}
+	err := Extract(buildTar(t, entries[:4]), dest, nil)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "passwd")); err == nil {
+		t.Errorf("Extract() wrote through an absolute symlink outside dest")
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, outside, "passwd")); err != nil || string(data) != "abs" {
+		t.Errorf("Extract() did not resolve the absolute symlink inside dest: %q, %v", data, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "rel")); err != nil || string(data) != "rel" {
+		t.Errorf("Extract() did not resolve the climbing symlink inside dest: %q, %v", data, err)
+	}
+
+	if err := Extract(buildTar(t, entries[4:]), dest, nil); err == nil {
+		t.Errorf("Extract() linked %s through a symlink", filepath.Join(outside, "secret"))
+	}
+}
+
+func TestExtractHardlinkToSymlink(t *testing.T) {
+	dest := t.TempDir()
+	entries := []tarEntry{
+		tarDir("etc/"),
+		tarFile("etc/passwd", "root"),
+		tarSymlink("passwd", "/etc/passwd"),
+		tarHardlink("link", "passwd"),
+	}
+	if err := Extract(buildTar(t, entries), dest, nil); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	fi, err := os.Lstat(filepath.Join(dest, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("hardlink to a symlink is a %v, want a symlink", fi.Mode())
+	}
+}
+
+func TestExtractOverlayWhiteouts(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("whiteouts and the opaque xattr need root")
+	}
+	entries := []tarEntry{
+		tarDir("dir/"),
+		tarFile("dir/"+WhiteoutOpaqueDir, ""),
+		tarFile("dir/"+WhiteoutPrefix+"gone", ""),
+		tarFile(WhiteoutPrefix+"top", ""),
+	}
+
+	dest := t.TempDir()
+	if err := Extract(buildTar(t, entries), dest, &ExtractOptions{OverlayWhiteouts: true}); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if !isOpaqueDir(filepath.Join(dest, "dir")) {
+		t.Errorf("dir is not opaque")
+	}
+	for _, name := range []string{"dir/gone", "top"} {
+		fi, err := os.Lstat(filepath.Join(dest, name))
+		if err != nil || !isOverlayWhiteout(fi) {
+			t.Errorf("%s is not a whiteout: %v", name, err)
+		}
+	}
+	for _, name := range []string{"dir/" + WhiteoutOpaqueDir, "dir/" + WhiteoutPrefix + "gone"} {
+		if _, err := os.Lstat(filepath.Join(dest, name)); err == nil {
+			t.Errorf("%s was extracted as a file", name)
+		}
+	}
+
+	// without the option whiteouts are plain files
+	dest = t.TempDir()
+	if err := Extract(buildTar(t, entries), dest, nil); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if fi, err := os.Lstat(filepath.Join(dest, WhiteoutPrefix+"top")); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("whiteout was converted without OverlayWhiteouts: %v", err)
+	}
+
+	// a whiteout can not name the directory itself or its parent
+	err := Extract(buildTar(t, []tarEntry{tarFile("dir/"+WhiteoutPrefix+"..", "")}), t.TempDir(), &ExtractOptions{OverlayWhiteouts: true})
+	if err == nil {
+		t.Errorf("Extract() accepted an invalid whiteout")
+	}
+}
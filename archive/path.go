@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinks bounds the symlinks followed while resolving a path, like the kernel's MAXSYMLINKS
+const maxSymlinks = 40
+
+// ErrPathEscape is returned for paths which would point outside the root
+var ErrPathEscape = errors.New("path escapes the root directory")
+
+/**
+ * @Description: SecureJoin joins unsafePath to root, resolving every symlink on the
+ *	way as if root were the filesystem root, so that the result never leaves root.
+ *	Components which do not exist are appended as they are.
+ * @param root root directory, e.g. the rootfs of a container
+ * @param unsafePath path inside root, absolute or relative to root
+ * @return path on the host, error
+ */
+func SecureJoin(root string, unsafePath string) (string, error) {
+	root = filepath.Clean(root)
+	var resolved string // path below root, always clean and starting with /
+	pending := unsafePath
+	links := 0
+
+	for pending != "" {
+		var part string
+		if idx := strings.IndexByte(pending, '/'); idx == -1 {
+			part, pending = pending, ""
+		} else {
+			part, pending = pending[:idx], pending[idx+1:]
+		}
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			// .. never climbs above the root, like on /
+			resolved = filepath.Dir("/" + resolved)
+			continue
+		}
+
+		next := filepath.Join("/", resolved, part)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+				return filepath.Join(root, next, filepath.Clean("/"+pending)), nil
+			}
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many symlinks resolving %s", unsafePath)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		// an absolute target restarts from the root, a relative one from the link's dir
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		pending = target + "/" + pending
+	}
+	return filepath.Join(root, resolved), nil
+}
+
+/**
+ * @Description: CleanEntryName checks an archive entry name and returns it relative to the
+ *	destination, a leading / is dropped but names climbing out with .. are rejected
+ * @param name entry name
+ * @return relative clean name, error
+ */
+func CleanEntryName(name string) (string, error) {
+	rel := filepath.Clean(strings.TrimLeft(name, "/"))
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%w: %s", ErrPathEscape, name)
+	}
+	return rel, nil
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecureJoin(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"etc", "usr/lib"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"lib":       "usr/lib",
+		"abs":       "/usr",
+		"escape":    "../../..",
+		"absescape": "/../etc",
+		"usr/up":    "../etc",
+		"loop":      "loop",
+		"file":      "etc/passwd",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc/passwd"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "", want: "/"},
+		{path: "/", want: "/"},
+		{path: "/etc", want: "/etc"},
+		{path: "etc/./", want: "/etc"},
+		{path: "/../../etc", want: "/etc"},
+		{path: "/lib/x", want: "/usr/lib/x"},
+		{path: "/abs/lib", want: "/usr/lib"},
+		{path: "/escape/etc", want: "/etc"},
+		{path: "/absescape", want: "/etc"},
+		{path: "/usr/up/passwd", want: "/etc/passwd"},
+		{path: "/missing/../../x", want: "/missing/x"},
+		{path: "/etc/passwd/x", want: "/etc/passwd/x"},
+		{path: "/file", want: "/etc/passwd"},
+		{path: "/loop", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := SecureJoin(root, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SecureJoin(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != filepath.Join(root, tt.want) {
+			t.Errorf("SecureJoin(%q) = %q, want %q", tt.path, got, filepath.Join(root, tt.want))
+		}
+	}
+}
+
+func TestCleanEntryName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "etc/passwd", want: "etc/passwd"},
+		{name: "/etc/passwd", want: "etc/passwd"},
+		{name: "./bin/", want: "bin"},
+		{name: "a/../b", want: "b"},
+		{name: "a/..b", want: "a/..b"},
+		{name: "..", wantErr: true},
+		{name: "../etc", wantErr: true},
+		{name: "a/../../etc", wantErr: true},
+		{name: "/../etc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := CleanEntryName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CleanEntryName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr && !errors.Is(err, ErrPathEscape) {
+			t.Errorf("CleanEntryName(%q) error = %v, want ErrPathEscape", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("CleanEntryName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * @Description: TarOptions controls how a directory is archived
+ * @param OCIWhiteouts convert overlayfs whiteouts into OCI whiteout files, for layers
+ * @param OneFileSystem leave out what is mounted below src, e.g. volumes of a container
+ * @param Name name of the top entry in the archive, e.g. a file name,
+ *	an empty name puts the entries of a directory at the top level
+ */
+type TarOptions struct {
+	OCIWhiteouts  bool
+	OneFileSystem bool
+	Name          string
+}
+
+/**
+ * @Description: Tar writes src and everything below it as a tar stream, keeping
+ *	ownership, permissions, times, xattrs, hardlinks, symlinks and device nodes
+ * @param w destination of the tar stream
+ * @param src file or directory to archive, symlinks in it are not followed
+ * @param opts tar options, nil for the defaults
+ * @return error
+ */
+func Tar(w io.Writer, src string, opts *TarOptions) error {
+	if opts == nil {
+		opts = &TarOptions{}
+	}
+	tw := tar.NewWriter(w)
+	// the first path of every hardlinked inode, later links point at it
+	links := make(map[fileID]string)
+	rootInfo, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(opts.Name, rel))
+		if name == "." {
+			// the directory itself has no entry in a layer
+			return nil
+		}
+
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if opts.OCIWhiteouts && isOverlayWhiteout(fi) {
+			return writeWhiteout(tw, filepath.Join(filepath.Dir(name), WhiteoutPrefix+filepath.Base(name)), fi)
+		}
+		if fi.Mode()&os.ModeSocket != 0 {
+			// sockets can not be archived, like in GNU tar
+			return nil
+		}
+
+		hdr, err := fileHeader(path, name, fi, links)
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if opts.OneFileSystem && fi.IsDir() && !sameDevice(fi, rootInfo) {
+			// keep the mountpoint, but not what is mounted on it
+			return filepath.SkipDir
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+			if err := copyFile(tw, path, hdr.Size); err != nil {
+				return err
+			}
+		}
+
+		if opts.OCIWhiteouts && fi.IsDir() && isOpaqueDir(path) {
+			return writeWhiteout(tw, filepath.Join(name, WhiteoutOpaqueDir), fi)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %v", src, err)
+	}
+	return tw.Close()
+}
+
+// fileID identifies an inode, inode numbers are only unique within a filesystem
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileHeader builds the tar header of a file, a repeated inode becomes a hardlink
+func fileHeader(path string, name string, fi os.FileInfo, links map[fileID]string) (*tar.Header, error) {
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return nil, err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = name
+	hdr.Format = tar.FormatPAX
+	// user and group names would be looked up on the host, ids are what counts
+	hdr.Uname, hdr.Gname = "", ""
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if fi.Mode().IsRegular() && st.Nlink > 1 {
+			id := fileID{dev: uint64(st.Dev), ino: st.Ino}
+			if first, ok := links[id]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+			} else {
+				links[id] = name
+			}
+		}
+	}
+
+	xattrs, err := readXattrs(path)
+	if err != nil {
+		return nil, err
+	}
+	for attr, value := range xattrs {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords[paxXattrPrefix+attr] = value
+	}
+	return hdr, nil
+}
+
+// writeWhiteout writes an empty OCI whiteout file owned by root
+func writeWhiteout(tw *tar.Writer, name string, fi os.FileInfo) error {
+	return tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0600,
+		ModTime:  fi.ModTime(),
+		Format:   tar.FormatPAX,
+	})
+}
+
+// sameDevice reports whether both files are on the same filesystem
+func sameDevice(a os.FileInfo, b os.FileInfo) bool {
+	sa, okA := a.Sys().(*syscall.Stat_t)
+	sb, okB := b.Sys().(*syscall.Stat_t)
+	return !okA || !okB || sa.Dev == sb.Dev
+}
+
+// isOverlayWhiteout reports whether the file is a 0/0 char device, how overlayfs marks deleted files
+func isOverlayWhiteout(fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && st.Rdev == 0
+}
+
+// isOpaqueDir reports whether overlayfs hides the lower layers below the directory
+func isOpaqueDir(path string) bool {
+	buf := make([]byte, 1)
+	n, err := unix.Lgetxattr(path, OverlayOpaqueXattr, buf)
+	return err == nil && n == 1 && buf[0] == 'y'
+}
+
+// readXattrs reads the extended attributes of a file, overlayfs internals are left out
+func readXattrs(path string) (map[string]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string]string)
+	for _, attr := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if attr == "" || strings.HasPrefix(attr, "trusted.overlay.") {
+			continue
+		}
+		valueSize, err := unix.Lgetxattr(path, attr, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, valueSize)
+		if valueSize, err = unix.Lgetxattr(path, attr, value); err != nil {
+			continue
+		}
+		xattrs[attr] = string(value[:valueSize])
+	}
+	return xattrs, nil
+}
+
+// copyFile copies size bytes of the file, a file growing meanwhile is cut at the size in its header
+func copyFile(w io.Writer, path string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.CopyN(w, file, size)
+	return err
+}
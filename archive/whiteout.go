@@ -0,0 +1,12 @@
+package archive
+
+// Whiteouts mark files deleted by an upper layer. Layer tarballs use the
+// OCI/AUFS format of empty marker files, overlayfs uses char devices and xattrs.
+const (
+	// WhiteoutPrefix prefixes the marker of a deleted file, e.g. .wh.foo deletes foo
+	WhiteoutPrefix = ".wh."
+	// WhiteoutOpaqueDir in a directory hides everything below it in the lower layers
+	WhiteoutOpaqueDir = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+	// OverlayOpaqueXattr marks an opaque directory on overlayfs
+	OverlayOpaqueXattr = "trusted.overlay.opaque"
+)
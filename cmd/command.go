@@ -10,8 +10,9 @@ import (
 
 var RunCommand = cli.Command{
 	Name: "run",
-	Usage: `Create a container with namespace and cgroups limit
-			mydocker run -it [command]`,
+	Usage: `Create a container from an image with namespace and cgroups limit
+			mydocker run -it [image] [command]
+			the command defaults to the Entrypoint and Cmd of the image`,
 
 	Flags: []cli.Flag{
 		cli.BoolFlag{
@@ -20,7 +21,7 @@ var RunCommand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:  "mem",
-			Usage: "memory max limit, e.g.: -mem 100m",
+			Usage: "memory max limit in bytes (k, m, g, t units), percentage of host memory or max, e.g.: -mem 100m",
 		},
 		cli.StringFlag{
 			Name:  "mem-min",
@@ -38,9 +39,21 @@ var RunCommand = cli.Command{
 			Name:  "mem-swap-max",
 			Usage: "memory swap max limit, e.g.: -mem-swap-max 100m",
 		},
+		cli.BoolFlag{
+			Name: "oom-group",
+			Usage: "kill all processes of the container together when it runs out of memory, e.g.: -oom-group",
+		},
 		cli.StringFlag{
 			Name: "cpu",
-			Usage: "max cpu usage of this group, e.g.: -cpu 100",
+			Usage: "max cpu usage of this group, max, percentage of one cpu or quota in microseconds, e.g.: -cpu 50%",
+		},
+		cli.StringFlag{
+			Name: "cpus",
+			Usage: "number of cpus this group can use, e.g.: -cpus 1.5",
+		},
+		cli.StringFlag{
+			Name: "cpu-period",
+			Usage: "cpu cfs period in microseconds, from 1000 to 1000000, e.g.: -cpu-period 50000",
 		},
 		cli.StringFlag{
 			Name: "cpu-weight",
@@ -54,16 +67,91 @@ var RunCommand = cli.Command{
 			Name: "cpuset",
 			Usage: "cpu set limit, e.g.: -cpuset 0-2 or -cpuset 0,1",
 		},
+		cli.StringFlag{
+			Name: "cpuset-mems",
+			Usage: "memory nodes limit, e.g.: -cpuset-mems 0-1 or -cpuset-mems 0",
+		},
+		cli.StringFlag{
+			Name: "cpuset-partition",
+			Usage: "make the cpuset an exclusive partition, root or isolated, e.g.: -cpuset-partition isolated",
+		},
+		cli.StringFlag{
+			Name: "pids-limit",
+			Usage: "max number of processes in the container, e.g.: -pids-limit 100",
+		},
+		cli.StringFlag{
+			Name: "blkio-weight",
+			Usage: "block io weight of this group, e.g.: -blkio-weight 500",
+		},
+		cli.StringSliceFlag{
+			Name: "device-read-bps",
+			Usage: "read bytes per second limit of a device, e.g.: -device-read-bps /dev/sda:1048576",
+		},
+		cli.StringSliceFlag{
+			Name: "device-write-bps",
+			Usage: "write bytes per second limit of a device, e.g.: -device-write-bps /dev/sda:1048576",
+		},
+		cli.StringSliceFlag{
+			Name: "device-read-iops",
+			Usage: "read io per second limit of a device, e.g.: -device-read-iops /dev/sda:1000",
+		},
+		cli.StringSliceFlag{
+			Name: "device-write-iops",
+			Usage: "write io per second limit of a device, e.g.: -device-write-iops /dev/sda:1000",
+		},
+		cli.StringFlag{
+			Name: "cgroup-parent",
+			Value: container.DefaultCgroupParent,
+			Usage: "parent cgroup of the container, relative to the cgroup root, e.g.: -cgroup-parent minidocker/batch",
+		},
+		cli.StringFlag{
+			Name: "cgroup-mode",
+			Usage: "strict aborts the container when a resource limit can not be applied, best-effort only warns;" +
+				" strict by default when any limit is given, e.g.: -cgroup-mode best-effort",
+		},
+		cli.BoolFlag{
+			Name: "cgroupns-rw",
+			Usage: "delegate the container's cgroup by mounting /sys/fs/cgroup read-write, e.g.: -cgroupns-rw",
+		},
+		cli.StringSliceFlag{
+			Name: "hugetlb",
+			Usage: "huge page usage limit of a page size, e.g.: -hugetlb 2MB:512m",
+		},
+		cli.StringSliceFlag{
+			Name: "pressure-trigger",
+			Usage: "warn when the container stalls on cpu, memory or io longer than threshold within window, e.g.: -pressure-trigger memory:some:150ms:1s",
+		},
 		cli.StringFlag{
 			Name: "v",
 			Usage: "volume path, e.g.: -v /home:/root",
 		},
+		cli.BoolFlag{
+			Name: "rm",
+			Usage: "remove the container when it exits, e.g.: -rm",
+		},
+		cli.StringFlag{
+			Name: "entrypoint",
+			Usage: "overwrite the entrypoint of the image, e.g.: -entrypoint /bin/sh",
+		},
+		cli.StringSliceFlag{
+			Name: "e",
+			Usage: "set an environment variable, KEY alone passes the host value, e.g.: -e FOO=bar",
+		},
+		cli.StringFlag{
+			Name: "w",
+			Usage: "working directory inside the container, e.g.: -w /app",
+		},
+		cli.StringFlag{
+			Name: "u",
+			Usage: "user[:group] or uid[:gid] to run the command as, e.g.: -u nobody",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 1 {
-			return fmt.Errorf("missing container command")
+			return fmt.Errorf("missing image")
 		}
-		cmd := context.Args()
+		imageRef := context.Args().First()
+		cmd := context.Args().Tail()
 		tty := context.Bool("it")
 		resConf := &cgroups.ResourceConfig{
 			MemoryMax: context.String("mem"),
@@ -71,23 +159,81 @@ var RunCommand = cli.Command{
 			MemoryLow: context.String("mem-low"),
 			MemoryHigh: context.String("mem-high"),
 			MemorySwapMax: context.String("mem-swap-max"),
+			MemoryOomGroup: context.Bool("oom-group"),
 			CpuMax: context.String("cpu"),
+			Cpus: context.String("cpus"),
+			CpuPeriod: context.String("cpu-period"),
 			CpuWeight: context.String("cpu-weight"),
 			CpuWeightNice: context.String("cpu-weight-nice"),
 			CpuSet: context.String("cpuset"),
+			CpuSetMems: context.String("cpuset-mems"),
+			CpuSetPartition: context.String("cpuset-partition"),
+			PidsMax: context.String("pids-limit"),
+			BlkioWeight: context.String("blkio-weight"),
+			DeviceReadBps: context.StringSlice("device-read-bps"),
+			DeviceWriteBps: context.StringSlice("device-write-bps"),
+			DeviceReadIops: context.StringSlice("device-read-iops"),
+			DeviceWriteIops: context.StringSlice("device-write-iops"),
+			HugetlbLimits: context.StringSlice("hugetlb"),
 		}
-		rootDir := "/home/lqb/go-project/minidocker/overlay"
 		volume := context.String("v")
-		Run(cmd, rootDir, volume, tty, resConf)
-		return nil
+		procOpts := &ProcessOptions{
+			Env: context.StringSlice("e"),
+			WorkingDir: context.String("w"),
+			User: context.String("u"),
+		}
+		if context.IsSet("entrypoint") {
+			entrypoint := context.String("entrypoint")
+			procOpts.Entrypoint = &entrypoint
+		}
+		cgOpts := &CgroupOptions{
+			Parent: context.String("cgroup-parent"),
+			Mode: context.String("cgroup-mode"),
+			Resources: resConf,
+			NamespaceRW: context.Bool("cgroupns-rw"),
+		}
+		for _, spec := range context.StringSlice("pressure-trigger") {
+			trigger, err := cgroups.ParsePressureTrigger(spec)
+			if err != nil {
+				return err
+			}
+			cgOpts.PressureTriggers = append(cgOpts.PressureTriggers, trigger)
+		}
+
+		if err := checkCgroupParent(cgOpts.Parent); err != nil {
+			return err
+		}
+		// Reject invalid limits before anything is created
+		if _, err := resConf.Normalize(); err != nil {
+			return err
+		}
+		// Limits were asked for, so running without them must not go unnoticed
+		switch cgOpts.Mode {
+		case "":
+			cgOpts.Mode = CgroupModeBestEffort
+			if !resConf.IsEmpty() {
+				cgOpts.Mode = CgroupModeStrict
+			}
+		case CgroupModeStrict, CgroupModeBestEffort:
+		default:
+			return fmt.Errorf("invalid cgroup mode [%s], must be %s or %s", cgOpts.Mode, CgroupModeStrict, CgroupModeBestEffort)
+		}
+
+		return Run(context.GlobalString("root"), imageRef, cmd, procOpts, volume, tty, context.Bool("rm"), cgOpts)
 	},
 }
 
 var InitCommand = cli.Command{
 	Name:  "init",
 	Usage: "Init container process run user's process in container. Do not call it outside",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "cgroupns-rw",
+			Usage: "mount the container's cgroup hierarchy read-write",
+		},
+	},
 	Action: func(context *cli.Context) error {
-		err := container.InitContainerProcess()
+		err := container.InitContainerProcess(context.Bool("cgroupns-rw"))
 		return err
 	},
 }
@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	archive "minidocker/archive"
+	container "minidocker/container"
+	image "minidocker/image"
+)
+
+// stopTimeout is how long rm -f waits for a killed container to be cleaned up by its run process
+const stopTimeout = 10 * time.Second
+
+var PsCommand = cli.Command{
+	Name:  "ps",
+	Usage: "List containers",
+	Action: func(context *cli.Context) error {
+		return listContainers(context.GlobalString("root"))
+	},
+}
+
+var CommitCommand = cli.Command{
+	Name: "commit",
+	Usage: `Create a new image from a container's changes
+			mydocker commit [container] [name:tag]`,
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "change, c",
+			Usage: "apply a Dockerfile instruction to the image config, e.g.: -change 'CMD [\"/bin/sh\"]'",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) != 2 {
+			return fmt.Errorf("usage: commit [container] [name:tag]")
+		}
+		return commitContainer(context.GlobalString("root"), context.Args().Get(0), context.Args().Get(1), context.StringSlice("change"))
+	},
+}
+
+var ExportCommand = cli.Command{
+	Name: "export",
+	Usage: `Export a container's filesystem as a tar archive, import turns it into a single layer image
+			mydocker export [container] -o [file]`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "o",
+			Usage: "write to a file instead of stdout, e.g.: -o rootfs.tar",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) != 1 {
+			return fmt.Errorf("usage: export [container] -o [file]")
+		}
+		return exportContainer(context.GlobalString("root"), context.Args().First(), context.String("o"))
+	},
+}
+
+var DiffCommand = cli.Command{
+	Name: "diff",
+	Usage: `Show the files added (A), changed (C) and deleted (D) in a container
+			mydocker diff [container]`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the changes as a json array of {Path, Kind}, kind 0 is changed, 1 added, 2 deleted, e.g.: -json",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) != 1 {
+			return fmt.Errorf("usage: diff [container]")
+		}
+		return diffContainer(context.GlobalString("root"), context.Args().First(), context.Bool("json"))
+	},
+}
+
+var RmCommand = cli.Command{
+	Name: "rm",
+	Usage: `Remove stopped containers
+			mydocker rm [-f] [container...]`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "f",
+			Usage: "kill and remove running containers, e.g.: -f",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing container")
+		}
+		return removeContainers(context.GlobalString("root"), context.Args(), context.Bool("f"))
+	},
+}
+
+// listContainers prints the containers as a table, the newest first
+func listContainers(root string) error {
+	infos, err := container.ListInfos(root)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Created.After(infos[j].Created)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER ID\tIMAGE\tCOMMAND\tCREATED\tSTATUS")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%q\t%s\t%s\n", info.ShortID(), info.Image, strings.Join(info.Command, " "),
+			humanDuration(time.Since(info.Created))+" ago", containerStatus(info))
+	}
+	return w.Flush()
+}
+
+// containerStatus describes the state of a container like docker ps
+func containerStatus(info *container.Info) string {
+	switch {
+	case info.State == nil:
+		return "Created"
+	case info.IsRunning():
+		return "Up " + humanDuration(time.Since(info.State.StartedAt))
+	case info.State.Status == container.StatusRunning:
+		// the run process died without recording the exit
+		return "Dead"
+	default:
+		return fmt.Sprintf("Exited (%d) %s ago", info.State.ExitCode, humanDuration(time.Since(info.State.FinishedAt)))
+	}
+}
+
+/**
+ * @Description: commitContainer turns the upper dir of a container into a layer on top of its image
+ * @param root root directory of minidocker
+ * @param id container id or prefix
+ * @param ref name[:tag] of the new image
+ * @param changes Dockerfile instructions applied to the image config
+ * @return error
+ */
+func commitContainer(root string, id string, ref string, changes []string) error {
+	info, err := container.FindInfo(root, id)
+	if err != nil {
+		return err
+	}
+	store, err := image.NewStore(root)
+	if err != nil {
+		return err
+	}
+	parent, err := store.Get(info.ImageID)
+	if err != nil {
+		return fmt.Errorf("failed to find image %s of container %s: %v", info.Image, info.ShortID(), err)
+	}
+	config, err := image.ApplyChanges(parent.Config, changes)
+	if err != nil {
+		return err
+	}
+	if info.IsRunning() {
+		log.Warnf("Container %s is running, files written during the commit may be inconsistent", info.ShortID())
+	}
+
+	upper := container.UpperDir(container.ContainerDir(root, info.ID))
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(archive.Tar(pw, upper, &archive.TarOptions{OCIWhiteouts: true}))
+	}()
+	img, err := store.Commit(parent, ref, pr, config)
+	// unblock the writer when the layer was not read to the end
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		log.Errorf("Failed to commit container %s: %v", info.ShortID(), err)
+		return err
+	}
+	fmt.Println(img.ID)
+	return nil
+}
+
+/**
+ * @Description: containerRootfs returns the root filesystem of a container, the merged dir of
+ *	a running container or a temporary mount of a stopped one, which cleanup unmounts
+ * @param root root directory of minidocker
+ * @param info container
+ * @param readOnly mount a stopped container read-only
+ * @return rootfs, cleanup, error
+ */
+func containerRootfs(root string, info *container.Info, readOnly bool) (string, func(), error) {
+	containerDir := container.ContainerDir(root, info.ID)
+	if info.IsRunning() {
+		return container.MergedDir(containerDir), func() {}, nil
+	}
+
+	store, err := image.NewStore(root)
+	if err != nil {
+		return "", nil, err
+	}
+	img, err := store.Get(info.ImageID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find image %s of container %s: %v", info.Image, info.ShortID(), err)
+	}
+	tmpRoot := filepath.Join(root, "tmp")
+	if err := os.MkdirAll(tmpRoot, 0700); err != nil {
+		return "", nil, err
+	}
+	target, err := os.MkdirTemp(tmpRoot, "mnt-")
+	if err != nil {
+		return "", nil, err
+	}
+	if err := container.MountStoppedWorkSpace(store.LowerDirs(img), containerDir, target, readOnly); err != nil {
+		os.Remove(target)
+		return "", nil, err
+	}
+	return target, func() {
+		container.UnmountStoppedWorkSpace(target)
+		os.Remove(target)
+	}, nil
+}
+
+// exportContainer writes the merged filesystem of a container as a tar, to stdout when output is empty
+func exportContainer(root string, id string, output string) (err error) {
+	if output == "" {
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			return fmt.Errorf("refusing to write the archive to a terminal, use -o or redirect stdout")
+		}
+		// logs would end up in the archive, even those of finding the container
+		log.SetOutput(os.Stderr)
+	}
+	info, err := container.FindInfo(root, id)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		file, createErr := os.Create(output)
+		if createErr != nil {
+			return createErr
+		}
+		defer func() {
+			closeErr := file.Close()
+			if err == nil {
+				err = closeErr
+			}
+			// a partial archive must not be mistaken for an export
+			if err != nil {
+				os.Remove(output)
+			}
+		}()
+		w = file
+	}
+
+	rootfs, cleanup, err := containerRootfs(root, info, true)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	// volumes are mounted below the merged dir of a running container, they are not its filesystem
+	if err := archive.Tar(w, rootfs, &archive.TarOptions{OneFileSystem: true}); err != nil {
+		log.Errorf("Failed to export container %s: %v", info.ShortID(), err)
+		return err
+	}
+	log.Infof("Container %s exported", info.ShortID())
+	return nil
+}
+
+// diffContainer prints the changes of a container to its image
+func diffContainer(root string, id string, asJSON bool) error {
+	info, err := container.FindInfo(root, id)
+	if err != nil {
+		return err
+	}
+	store, err := image.NewStore(root)
+	if err != nil {
+		return err
+	}
+	img, err := store.Get(info.ImageID)
+	if err != nil {
+		return fmt.Errorf("failed to find image %s of container %s: %v", info.Image, info.ShortID(), err)
+	}
+
+	upper := container.UpperDir(container.ContainerDir(root, info.ID))
+	changes, err := archive.OverlayChanges(store.LowerDirs(img), upper)
+	if err != nil {
+		log.Errorf("Failed to diff container %s: %v", info.ShortID(), err)
+		return err
+	}
+
+	if asJSON {
+		if changes == nil {
+			changes = []archive.Change{}
+		}
+		return json.NewEncoder(os.Stdout).Encode(changes)
+	}
+	for _, change := range changes {
+		fmt.Printf("%s %s\n", change.Kind, change.Path)
+	}
+	return nil
+}
+
+// removeContainers removes every container, running ones are killed first when forced
+func removeContainers(root string, ids []string, force bool) error {
+	var failed int
+	for _, id := range ids {
+		if err := removeContainer(root, id, force); err != nil {
+			log.Errorf("Failed to remove container %s: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d container(s)", failed)
+	}
+	return nil
+}
+
+func removeContainer(root string, id string, force bool) error {
+	info, err := container.FindInfo(root, id)
+	if err != nil {
+		return err
+	}
+	if info.IsRunning() {
+		if !force {
+			return fmt.Errorf("container %s is running, use -f to kill it", info.ShortID())
+		}
+		if err := killContainer(info); err != nil {
+			return fmt.Errorf("failed to kill container %s: %v", info.ShortID(), err)
+		}
+		waitStopped(root, info)
+	}
+
+	if err := container.RemoveInfo(root, info.ID); err != nil {
+		return err
+	}
+	fmt.Println(info.ShortID())
+	return nil
+}
+
+// killContainer kills the processes of a running container through its cgroup, the pid is
+// only used for a container without one, IsRunning has checked that it was not reused
+func killContainer(info *container.Info) error {
+	if info.State.Cgroup == "" {
+		if err := syscall.Kill(info.State.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return err
+		}
+		return nil
+	}
+	cgroupManager, err := container.GetCgroupsManager()
+	if err != nil {
+		return err
+	}
+	return cgroupManager.Kill(info.State.Cgroup)
+}
+
+// waitStopped waits until the run process of a killed container recorded its exit and cleaned up
+func waitStopped(root string, info *container.Info) {
+	deadline := time.Now().Add(stopTimeout)
+	for time.Now().Before(deadline) {
+		current, err := container.LoadInfo(root, info.ID)
+		if err != nil || current.State == nil || current.State.Status == container.StatusStopped {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Warnf("Container %s did not record its exit in %v", info.ShortID(), stopTimeout)
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	archive "minidocker/archive"
+	container "minidocker/container"
+)
+
+var CpCommand = cli.Command{
+	Name: "cp",
+	Usage: `Copy files between a container and the host, - streams a tar archive from stdin or to stdout
+			mydocker cp [container]:[path] [hostpath|-]
+			mydocker cp [hostpath|-] [container]:[path]`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "L",
+			Usage: "follow a symlink in the source path, e.g.: -L",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) != 2 {
+			return fmt.Errorf("usage: cp [container]:[path] [hostpath|-] or cp [hostpath|-] [container]:[path]")
+		}
+		root := context.GlobalString("root")
+		srcContainer, srcPath := splitCpArg(context.Args().Get(0))
+		dstContainer, dstPath := splitCpArg(context.Args().Get(1))
+
+		switch {
+		case srcContainer != "" && dstContainer == "":
+			return copyFromContainer(root, srcContainer, srcPath, dstPath, context.Bool("L"))
+		case srcContainer == "" && dstContainer != "":
+			return copyToContainer(root, srcPath, dstContainer, dstPath, context.Bool("L"))
+		default:
+			return fmt.Errorf("exactly one of source and destination must be a container path")
+		}
+	},
+}
+
+// splitCpArg splits container:path, a local path such as ./a:b has a slash before the colon
+func splitCpArg(arg string) (string, string) {
+	if arg == "-" || strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") {
+		return "", arg
+	}
+	name, path, ok := strings.Cut(arg, ":")
+	if !ok || strings.Contains(name, "/") {
+		return "", arg
+	}
+	return name, path
+}
+
+/**
+ * @Description: copyFromContainer copies a path of a container to the host, symlinks on
+ *	the way are resolved inside the container root
+ * @param root root directory of minidocker
+ * @param id container id or prefix
+ * @param srcPath path inside the container, ending in /. copies the contents of a directory
+ * @param dstPath host path, - writes a tar archive to stdout
+ * @param follow follow a symlink in the last component of srcPath
+ * @return error
+ */
+func copyFromContainer(root string, id string, srcPath string, dstPath string, follow bool) error {
+	if dstPath == "-" {
+		// logs would end up in the archive, even those of finding the container
+		log.SetOutput(os.Stderr)
+	}
+	info, err := container.FindInfo(root, id)
+	if err != nil {
+		return err
+	}
+	thaw, err := freezeContainer(info)
+	if err != nil {
+		return err
+	}
+	defer thaw()
+	rootfs, cleanup, err := containerRootfs(root, info, true)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	src, err := resolvePath(rootfs, srcPath, follow)
+	if err != nil {
+		return err
+	}
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("no such path in container %s: %s", info.ShortID(), srcPath)
+	}
+
+	// the copy is named after the path in the container, not the link target or the mountpoint
+	name := copyName(srcPath)
+	if dstPath == "-" {
+		return archive.Tar(os.Stdout, src, &archive.TarOptions{Name: name, OneFileSystem: true})
+	}
+	dstDir, name, err := copyTarget(dstPath, srcInfo.IsDir(), name)
+	if err != nil {
+		return fmt.Errorf("invalid destination %s: %v", dstPath, err)
+	}
+	return copyTree(src, name, dstDir, &archive.ExtractOptions{})
+}
+
+/**
+ * @Description: copyToContainer copies a host path into a container, symlinks on the way
+ *	to the destination are resolved inside the container root
+ * @param root root directory of minidocker
+ * @param srcPath host path, ending in /. copies the contents of a directory, - reads a tar archive from stdin
+ * @param id container id or prefix
+ * @param dstPath path inside the container, must be a directory when reading from stdin
+ * @param follow follow a symlink in the last component of srcPath
+ * @return error
+ */
+func copyToContainer(root string, srcPath string, id string, dstPath string, follow bool) error {
+	info, err := container.FindInfo(root, id)
+	if err != nil {
+		return err
+	}
+	thaw, err := freezeContainer(info)
+	if err != nil {
+		return err
+	}
+	defer thaw()
+	rootfs, cleanup, err := containerRootfs(root, info, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	dst, err := archive.SecureJoin(rootfs, dstPath)
+	if err != nil {
+		return err
+	}
+
+	if srcPath == "-" {
+		if fi, err := os.Stat(dst); err != nil || !fi.IsDir() {
+			return fmt.Errorf("destination %s must be a directory in container %s", dstPath, info.ShortID())
+		}
+		return archive.Extract(os.Stdin, rootfs, &archive.ExtractOptions{Prefix: relPath(rootfs, dst)})
+	}
+
+	src := srcPath
+	if follow {
+		if src, err = filepath.EvalSymlinks(srcPath); err != nil {
+			return err
+		}
+	}
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	dstDir, name, err := copyTarget(dst, srcInfo.IsDir(), copyName(srcPath))
+	if err != nil {
+		return fmt.Errorf("invalid destination %s in container %s: %v", dstPath, info.ShortID(), err)
+	}
+	return copyTree(src, name, rootfs, &archive.ExtractOptions{Prefix: relPath(rootfs, dstDir)})
+}
+
+/**
+ * @Description: freezeContainer stops the processes of a running container for a copy. Paths
+ *	are resolved inside the container once and then opened again, a process of the container
+ *	could swap a component for a symlink in between and reach files of the host.
+ * @param info container to freeze
+ * @return function thawing the container, error when a running container can not be frozen
+ */
+func freezeContainer(info *container.Info) (func(), error) {
+	if !info.IsRunning() {
+		// the filesystem of a stopped container is mounted for the copy alone
+		return func() {}, nil
+	}
+	if info.State.Cgroup == "" {
+		return nil, fmt.Errorf("container %s has no cgroup to freeze, can not copy while it runs", info.ShortID())
+	}
+	cgroupManager, err := container.GetCgroupsManager()
+	if err != nil {
+		return nil, err
+	}
+	if err := cgroupManager.Freeze(info.State.Cgroup); err != nil {
+		return nil, fmt.Errorf("failed to freeze container %s, can not copy while it runs: %v", info.ShortID(), err)
+	}
+	return func() {
+		if err := cgroupManager.Thaw(info.State.Cgroup); err != nil {
+			log.Errorf("Failed to thaw container %s: %v", info.ShortID(), err)
+		}
+	}, nil
+}
+
+// resolvePath resolves a path inside rootfs, the last component is only followed when it is asked for
+func resolvePath(rootfs string, path string, follow bool) (string, error) {
+	if follow || isContentsPath(path) {
+		return archive.SecureJoin(rootfs, path)
+	}
+	parent, err := archive.SecureJoin(rootfs, filepath.Dir(filepath.Clean("/"+path)))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, filepath.Base(filepath.Clean("/"+path))), nil
+}
+
+/**
+ * @Description: copyTarget works out where a copy goes like cp -a does: into an existing
+ *	directory under the source name, otherwise to the destination path itself
+ * @param dst destination path
+ * @param srcIsDir whether the source is a directory
+ * @param name name of the copy, see copyName, empty copies the contents of the source directory
+ * @return directory to copy into, name of the copy, empty for the contents, error
+ */
+func copyTarget(dst string, srcIsDir bool, name string) (string, string, error) {
+	if fi, err := os.Stat(dst); err == nil {
+		if fi.IsDir() {
+			return dst, name, nil
+		}
+		if srcIsDir {
+			return "", "", fmt.Errorf("can not copy a directory to a file")
+		}
+		return filepath.Dir(dst), filepath.Base(dst), nil
+	}
+
+	if !srcIsDir && strings.HasSuffix(dst, "/") {
+		return "", "", fmt.Errorf("destination directory does not exist")
+	}
+	parent := filepath.Dir(filepath.Clean(dst))
+	if fi, err := os.Stat(parent); err != nil || !fi.IsDir() {
+		return "", "", fmt.Errorf("parent directory does not exist")
+	}
+	return parent, filepath.Base(filepath.Clean(dst)), nil
+}
+
+// copyTree streams src through a tar archive into dstDir under name
+func copyTree(src string, name string, dstDir string, opts *archive.ExtractOptions) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(archive.Tar(pw, src, &archive.TarOptions{Name: name, OneFileSystem: true}))
+	}()
+	err := archive.Extract(pr, dstDir, opts)
+	// unblock the writer when the archive was not read to the end
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %v", src, err)
+	}
+	return nil
+}
+
+// copyName returns the name a copy of path gets, empty when the contents of a directory
+// are copied, e.g. for / or dir/.
+func copyName(path string) string {
+	if isContentsPath(path) {
+		return ""
+	}
+	name := filepath.Base(filepath.Clean("/" + path))
+	if name == "/" {
+		return ""
+	}
+	return name
+}
+
+// isContentsPath reports whether a path ends in /., which copies the contents of a directory
+func isContentsPath(path string) bool {
+	return strings.HasSuffix(path, "/.") || path == "."
+}
+
+// relPath returns path relative to rootfs, path is inside rootfs
+func relPath(rootfs string, path string) string {
+	rel, err := filepath.Rel(rootfs, path)
+	if err != nil {
+		return "."
+	}
+	return rel
+}
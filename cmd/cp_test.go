@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitCpArg(t *testing.T) {
+	tests := []struct {
+		arg       string
+		container string
+		path      string
+	}{
+		{arg: "abc:/etc", container: "abc", path: "/etc"},
+		{arg: "abc:etc/hosts", container: "abc", path: "etc/hosts"},
+		{arg: "abc:", container: "abc", path: ""},
+		{arg: "-", path: "-"},
+		{arg: "file", path: "file"},
+		{arg: "/tmp/a:b", path: "/tmp/a:b"},
+		{arg: "./a:b", path: "./a:b"},
+		{arg: "../a:b", path: "../a:b"},
+		{arg: "dir/a:b", path: "dir/a:b"},
+	}
+	for _, tt := range tests {
+		container, path := splitCpArg(tt.arg)
+		if container != tt.container || path != tt.path {
+			t.Errorf("splitCpArg(%q) = %q, %q, want %q, %q", tt.arg, container, path, tt.container, tt.path)
+		}
+	}
+}
+
+func TestCopyName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/etc", want: "etc"},
+		{path: "/etc/", want: "etc"},
+		{path: "etc/hosts", want: "hosts"},
+		{path: "/etc/..", want: ""},
+		{path: "../../lib", want: "lib"},
+		{path: "/", want: ""},
+		{path: "", want: ""},
+		{path: ".", want: ""},
+		{path: "/etc/.", want: ""},
+	}
+	for _, tt := range tests {
+		if got := copyName(tt.path); got != tt.want {
+			t.Errorf("copyName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCopyTarget(t *testing.T) {
+	tmp := t.TempDir()
+	dir, file := filepath.Join(tmp, "dir"), filepath.Join(tmp, "file")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dst      string
+		srcIsDir bool
+		name     string
+		wantDir  string
+		wantName string
+		wantErr  bool
+	}{
+		// into an existing directory
+		{dst: dir, srcIsDir: true, name: "etc", wantDir: dir, wantName: "etc"},
+		{dst: dir + "/", srcIsDir: false, name: "hosts", wantDir: dir + "/", wantName: "hosts"},
+		{dst: dir, srcIsDir: true, name: "", wantDir: dir, wantName: ""},
+		// over an existing file
+		{dst: file, srcIsDir: false, name: "hosts", wantDir: tmp, wantName: "file"},
+		{dst: file, srcIsDir: true, name: "etc", wantErr: true},
+		// to a new path
+		{dst: filepath.Join(tmp, "new"), srcIsDir: false, name: "hosts", wantDir: tmp, wantName: "new"},
+		{dst: filepath.Join(tmp, "new") + "/", srcIsDir: true, name: "etc", wantDir: tmp, wantName: "new"},
+		{dst: filepath.Join(tmp, "new"), srcIsDir: true, name: "", wantDir: tmp, wantName: "new"},
+		{dst: filepath.Join(tmp, "new") + "/", srcIsDir: false, name: "hosts", wantErr: true},
+		{dst: filepath.Join(tmp, "missing", "new"), srcIsDir: false, name: "hosts", wantErr: true},
+		{dst: filepath.Join(file, "new"), srcIsDir: false, name: "hosts", wantErr: true},
+	}
+	for _, tt := range tests {
+		gotDir, gotName, err := copyTarget(tt.dst, tt.srcIsDir, tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("copyTarget(%q, %v, %q) error = %v, wantErr %v", tt.dst, tt.srcIsDir, tt.name, err, tt.wantErr)
+			continue
+		}
+		if gotDir != tt.wantDir || gotName != tt.wantName {
+			t.Errorf("copyTarget(%q, %v, %q) = %q, %q, want %q, %q",
+				tt.dst, tt.srcIsDir, tt.name, gotDir, gotName, tt.wantDir, tt.wantName)
+		}
+	}
+}
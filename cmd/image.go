@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	container "minidocker/container"
+	image "minidocker/image"
+)
+
+var ImportCommand = cli.Command{
+	Name: "import",
+	Usage: `Create an image from a root filesystem tarball, gzip, bzip2, xz and zstd are detected
+			mydocker import [tarball|-] [name:tag]`,
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) != 2 {
+			return fmt.Errorf("usage: import [tarball|-] [name:tag]")
+		}
+		return importImage(context.GlobalString("root"), context.Args().Get(0), context.Args().Get(1))
+	},
+}
+
+var LoadCommand = cli.Command{
+	Name: "load",
+	Usage: `Load images from an OCI image layout or docker save archive
+			mydocker load -i [archive] [name]
+			name is the repository of OCI images annotated with a tag only, they are loaded untagged without it`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "i",
+			Usage: "read from the archive instead of stdin, e.g.: -i busybox.tar",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) > 1 {
+			return fmt.Errorf("usage: load -i [archive] [name]")
+		}
+		return loadImages(context.GlobalString("root"), context.String("i"), context.Args().First())
+	},
+}
+
+var ImagesCommand = cli.Command{
+	Name:  "images",
+	Usage: "List images",
+	Action: func(context *cli.Context) error {
+		return listImages(context.GlobalString("root"))
+	},
+}
+
+var RmiCommand = cli.Command{
+	Name: "rmi",
+	Usage: `Remove images
+			mydocker rmi [-f] [image...]`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "f",
+			Usage: "untag the image even if stopped containers use it, or remove all its tags when given by id, e.g.: -f",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing image")
+		}
+		return removeImages(context.GlobalString("root"), context.Args(), context.Bool("f"))
+	},
+}
+
+var ImageCommand = cli.Command{
+	Name:  "image",
+	Usage: "Manage images",
+	Subcommands: []cli.Command{
+		{
+			Name:   "import",
+			Usage:  ImportCommand.Usage,
+			Action: ImportCommand.Action,
+		},
+		{
+			Name:   "load",
+			Usage:  LoadCommand.Usage,
+			Flags:  LoadCommand.Flags,
+			Action: LoadCommand.Action,
+		},
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   ImagesCommand.Usage,
+			Action:  ImagesCommand.Action,
+		},
+		{
+			Name:   "rm",
+			Usage:  RmiCommand.Usage,
+			Flags:  RmiCommand.Flags,
+			Action: RmiCommand.Action,
+		},
+	},
+}
+
+// importImage imports a tarball, - reads it from stdin
+func importImage(root string, source string, ref string) error {
+	store, err := image.NewStore(root)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			log.Errorf("Failed to open %s: %v", source, err)
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	img, err := store.Import(ref, r)
+	if err != nil {
+		log.Errorf("Failed to import %s: %v", source, err)
+		return err
+	}
+	fmt.Println(img.ID)
+	return nil
+}
+
+// loadImages loads an image archive, stdin is read when input is empty
+func loadImages(root string, input string, name string) error {
+	store, err := image.NewStore(root)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if input != "" {
+		file, err := os.Open(input)
+		if err != nil {
+			log.Errorf("Failed to open %s: %v", input, err)
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	images, err := store.Load(r, name)
+	for _, img := range images {
+		if img.Name == "" {
+			fmt.Printf("Loaded image ID: %s\n", img.ID)
+			continue
+		}
+		fmt.Printf("Loaded image: %s\n", img.Reference())
+	}
+	if err != nil {
+		log.Errorf("Failed to load %s: %v", input, err)
+		return err
+	}
+	return nil
+}
+
+// listImages prints the images as a table
+func listImages(root string) error {
+	store, err := image.NewStore(root)
+	if err != nil {
+		return err
+	}
+	images, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tTAG\tIMAGE ID\tCREATED\tSIZE")
+	for _, img := range images {
+		name, tag := img.Name, img.Tag
+		if name == "" {
+			name, tag = "<none>", "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			name, tag, img.ID[:12], humanDuration(time.Since(img.Created))+" ago", humanSize(img.Size))
+	}
+	return w.Flush()
+}
+
+// removeImages removes every image, images used by a container are kept unless forced
+func removeImages(root string, refs []string, force bool) error {
+	store, err := image.NewStore(root)
+	if err != nil {
+		return err
+	}
+	infos, err := container.ListInfos(root)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, ref := range refs {
+		img, err := store.Get(ref)
+		if err != nil {
+			log.Errorf("Failed to remove image %s: %v", ref, err)
+			failed++
+			continue
+		}
+		user, err := imageUser(img, infos, force)
+		if err != nil {
+			log.Errorf("Failed to remove image %s: %v", ref, err)
+			failed++
+			continue
+		}
+		if err := removeImage(store, img, ref, force, user); err != nil {
+			log.Errorf("Failed to remove image %s: %v", ref, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d image(s)", failed)
+	}
+	return nil
+}
+
+// removeImage untags ref, an image given by id loses all its tags like docker does,
+// which needs force when it has more than one. An image used by a stopped container
+// is only untagged and kept dangling, the container still needs its layers.
+func removeImage(store *image.Store, img *image.Image, ref string, force bool, user *container.Info) error {
+	tags, err := store.Tags(img)
+	if err != nil {
+		return err
+	}
+	remove := store.Remove
+	if user != nil && len(tags) > 0 {
+		log.Warnf("Image %s is used by stopped container %s, it is only untagged", ref, user.ShortID())
+		remove = store.Untag
+	}
+	if name, tag, err := image.ParseReference(ref); err == nil {
+		for _, t := range tags {
+			if t == name+":"+tag {
+				img.Name, img.Tag = name, tag
+				return remove(img)
+			}
+		}
+	}
+
+	if len(tags) > 1 && !force {
+		return fmt.Errorf("image is referenced in multiple repositories (%s), use -f to remove it anyway", strings.Join(tags, ", "))
+	}
+	if len(tags) == 0 {
+		if user != nil {
+			return fmt.Errorf("image is used by container %s, remove the container first", user.ShortID())
+		}
+		// untagged, Remove deletes it as no tag remains
+		return store.Remove(img)
+	}
+	for _, t := range tags {
+		img.Name, img.Tag, _ = image.ParseReference(t)
+		if err := remove(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageUser returns a stopped container using the image, it fails if a container uses the
+// image and force is not set, running containers always block removal
+func imageUser(img *image.Image, infos []*container.Info, force bool) (*container.Info, error) {
+	var user *container.Info
+	for _, info := range infos {
+		if info.ImageID != img.ID {
+			continue
+		}
+		if info.IsRunning() {
+			return nil, fmt.Errorf("image is used by running container %s", info.ShortID())
+		}
+		if !force {
+			return nil, fmt.Errorf("image is used by container %s, use -f to untag it anyway", info.ShortID())
+		}
+		user = info
+	}
+	return user, nil
+}
+
+// humanSize formats a size in bytes with decimal units, like docker
+func humanSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.3g%s", value, units[i])
+}
+
+// humanDuration formats a duration roughly, e.g. 3 hours
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%d months", int(d.Hours()/24/30))
+	default:
+		return fmt.Sprintf("%d years", int(d.Hours()/24/365))
+	}
+}
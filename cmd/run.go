@@ -1,51 +1,273 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	container "minidocker/container"
 	cgroups "minidocker/container/cgroups"
-	"os"
+	image "minidocker/image"
+	"os/exec"
+	"path"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// How failures to apply resource limits are handled
+const (
+	// CgroupModeStrict aborts the container start
+	CgroupModeStrict = "strict"
+	// CgroupModeBestEffort logs a warning and runs the container without limits
+	CgroupModeBestEffort = "best-effort"
+)
+
+/**
+ * @Description: CgroupOptions groups the cgroup settings of a container
+ * @param Parent parent cgroup of the container, relative to the cgroup root
+ * @param Mode CgroupModeStrict or CgroupModeBestEffort
+ * @param Resources resource limits of the container
+ * @param PressureTriggers pressure triggers to register on the container cgroup
+ * @param NamespaceRW mount the container's cgroup hierarchy read-write to delegate it
+ */
+type CgroupOptions struct {
+	Parent           string
+	Mode             string
+	Resources        *cgroups.ResourceConfig
+	PressureTriggers []*cgroups.PressureTriggerConfig
+	NamespaceRW      bool
+}
+
+// checkCgroupParent rejects a parent cgroup which is not below the cgroup root
+func checkCgroupParent(parent string) error {
+	if path.IsAbs(parent) {
+		return fmt.Errorf("invalid cgroup parent [%s], must be relative to the cgroup root", parent)
+	}
+	for _, part := range strings.Split(parent, "/") {
+		if part == ".." {
+			return fmt.Errorf("invalid cgroup parent [%s], must not contain ..", parent)
+		}
+	}
+	return nil
+}
+
 /**
- * @Description: Run command in separate container,
+ * @Description: Run command in separate container created from an image,
  *	if tty is true, then attach stdin, stdout, stderr to os.Stdin, os.Stdout, os.Stderr
- * @param cmd command to run
- * @param rootDir root directory of the container
+ * @param root root directory of minidocker, holding images and containers
+ * @param imageRef name[:tag] or id of the image
+ * @param cmd command line arguments after the image, replacing the image Cmd
+ * @param procOpts command line overrides of the image config
+ * @param volume volume of the container, e.g. /home:/root
  * @param tty attach stdin, stdout, stderr to os.Stdin, os.Stdout, os.Stderr
- * @return void
+ * @param autoRemove delete the container when it exits instead of keeping its changes
+ * @param cgOpts cgroup settings of the container
+ * @return error
  */
-func Run(cmd []string, rootDir string, volume string, tty bool, res *cgroups.ResourceConfig) {
-	parent, writePipe, err := container.NewProcess(cmd, rootDir, volume, tty)
-	defer container.DeleteWorkSpace(rootDir, volume)
+func Run(root string, imageRef string, cmd []string, procOpts *ProcessOptions, volume string, tty bool, autoRemove bool, cgOpts *CgroupOptions) error {
+	store, err := image.NewStore(root)
 	if err != nil {
-		log.Errorf("Failed to create process: %v", err)
-		return
+		return err
+	}
+	img, err := store.Get(imageRef)
+	if err != nil {
+		log.Errorf("Failed to find image %s: %v", imageRef, err)
+		return err
 	}
 
-	if err := parent.Start(); err != nil {
-		log.Errorf("Failed to start process: %v", err)
+	spec, err := buildInitSpec(img.Config, cmd, procOpts)
+	if err != nil {
+		return err
+	}
+
+	info, err := container.NewInfo(root, img.Reference(), img.ID, spec.Args, volume)
+	if err != nil {
+		log.Errorf("Failed to create container: %v", err)
+		return err
 	}
+	containerDir := container.ContainerDir(root, info.ID)
+	// A stopped container keeps its upper dir for commit, one which never started is dropped
+	started := false
+	log.Infof("Container %s created from image %s", info.ShortID(), img.Reference())
 
-	log.Infof("Rescource config: %v", res)
+	parent, writePipe, err := container.NewProcess(spec.Args, store.LowerDirs(img), containerDir, volume, tty, cgOpts.NamespaceRW)
+	defer func() {
+		if autoRemove || !started {
+			container.DeleteWorkSpace(containerDir, volume)
+			_ = container.RemoveInfo(root, info.ID)
+			return
+		}
+		container.UnmountWorkSpace(containerDir, volume)
+	}()
+	if err != nil {
+		log.Errorf("Failed to create process: %v", err)
+		return err
+	}
+
+	log.Infof("Rescource config: %v", cgOpts.Resources)
+
+	// Prepare the cgroup before the process exists, so that no user code runs unconstrained
+	cgroupName := path.Join(cgOpts.Parent, info.ID)
 	cgroupManager, err := container.GetCgroupsManager()
 	if err == nil {
-		cgroupManager.CreateCgroup("minidocker-cgroup")
-		cgroupManager.Set("minidocker-cgroup", res)
-		cgroupManager.Apply("minidocker-cgroup", parent.Process.Pid)
-		defer cgroupManager.Destroy("minidocker-cgroup")
+		defer cgroupManager.Destroy(cgroupName)
+		err = prepareCgroup(cgroupManager, cgroupName, cgOpts.Resources)
+	}
+	if err != nil {
+		if cgOpts.Mode == CgroupModeStrict {
+			log.Errorf("Failed to apply resource limits, aborting: %v", err)
+			_ = writePipe.Close()
+			return fmt.Errorf("failed to apply resource limits: %v", err)
+		}
+		log.Warnf("Failed to apply resource limits, the container runs without them: %v", err)
+	}
+	cgroupReady := err == nil
+
+	// On cgroup v2 clone the process straight into its cgroup
+	if cgroupReady && cgroupManager.Version() == container.CgroupV2 {
+		if cgroupFD, err := cgroupManager.OpenCgroupFD(cgroupName); err == nil {
+			defer cgroupFD.Close()
+			parent.SysProcAttr.UseCgroupFD = true
+			parent.SysProcAttr.CgroupFD = int(cgroupFD.Fd())
+		} else {
+			log.Warnf("Failed to open cgroup %s: %v", cgroupName, err)
+		}
 	}
 
-	// send init command to child process
-	sendInitCommand(cmd, writePipe)
+	err = parent.Start()
+	if err != nil && parent.SysProcAttr.UseCgroupFD && (errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EINVAL)) {
+		// Kernels before 5.7 have no CLONE_INTO_CGROUP, the child is held on
+		// the init pipe until Apply below moves it into the cgroup instead.
+		log.Warnf("Failed to clone into cgroup, falling back to moving the process: %v", err)
+		parent = cloneCommand(parent)
+		parent.SysProcAttr.UseCgroupFD = false
+		err = parent.Start()
+	}
+	if err != nil {
+		log.Errorf("Failed to start process: %v", err)
+		return err
+	}
+
+	state := &container.State{
+		Pid:       parent.Process.Pid,
+		Status:    container.StatusRunning,
+		StartedAt: time.Now(),
+	}
+	if startTime, err := container.ProcessStartTime(state.Pid); err == nil {
+		state.PidStartTime = startTime
+	} else {
+		log.Warnf("Failed to read the start time of process %d: %v", state.Pid, err)
+	}
+	if cgroupReady {
+		state.Cgroup = cgroupName
+	}
+	info.State = state
+	if err := info.Save(root); err != nil {
+		log.Warnf("Failed to save container state: %v", err)
+	}
+
+	if cgroupReady && !parent.SysProcAttr.UseCgroupFD {
+		// The child does not run user code before it reads the init command,
+		// which is only sent once it is inside the cgroup.
+		if err := cgroupManager.Apply(cgroupName, parent.Process.Pid); err != nil {
+			err = fmt.Errorf("failed to apply cgroup %s to pid %d: %v", cgroupName, parent.Process.Pid, err)
+			if cgOpts.Mode == CgroupModeStrict {
+				log.Errorf("Failed to apply resource limits, aborting: %v", err)
+				_ = writePipe.Close()
+				killProcess(parent)
+				return err
+			}
+			log.Warnf("Failed to apply resource limits, the container runs without them: %v", err)
+			cgroupReady = false
+			state.Cgroup = ""
+		}
+	}
+
+	if cgroupReady {
+		if monitor, err := cgroupManager.WatchOOM(cgroupName); err == nil {
+			defer monitor.Close()
+			go func() {
+				for events := range monitor.Events() {
+					log.Warnf("Container hit its memory limit, oom: %d, oom_kill: %d", events.OOM, events.OOMKill)
+				}
+			}()
+		} else {
+			log.Warnf("Failed to watch oom events: %v", err)
+		}
+
+		for _, cfg := range cgOpts.PressureTriggers {
+			trigger, err := cgroupManager.WatchPressure(cgroupName, cfg)
+			if err != nil {
+				log.Warnf("Failed to register pressure trigger %s: %v", cfg, err)
+				continue
+			}
+			defer trigger.Close()
+			go func() {
+				for event := range trigger.Events() {
+					log.Warnf("Container under sustained %s pressure (%s), stats: %+v",
+						event.Trigger.Resource, event.Trigger.String(), event.Stats)
+				}
+			}()
+		}
+	}
+
+	// send init spec to child process, from here on user code may change the container
+	started = true
+	if err := container.SendInitSpec(spec, writePipe); err != nil {
+		log.Errorf("Failed to start container: %v", err)
+	}
 	_ = parent.Wait()
+
+	state.Status = container.StatusStopped
+	state.ExitCode = parent.ProcessState.ExitCode()
+	state.FinishedAt = time.Now()
+	if cgroupManager != nil {
+		// Read the counters after exit, the monitor may miss the last kill
+		if events, err := cgroupManager.GetMemoryEvents(cgroupName); err == nil && events.OOMKill > 0 {
+			state.OOMKilled = true
+			state.OOMKillCount = events.OOMKill
+			log.Errorf("Container was killed by the OOM killer, %d process(es) killed", events.OOMKill)
+		}
+		if stats, err := cgroupManager.GetStats(cgroupName); err == nil {
+			log.Infof("Container stats: %+v", *stats)
+		}
+	}
+	log.Infof("Container state: %+v", *state)
+	if err := info.Save(root); err != nil {
+		log.Warnf("Failed to save container state: %v", err)
+	}
+	return nil
 }
 
-// sendInitCommand 通过writePipe将指令发送给子进程
-func sendInitCommand(comArray []string, writePipe *os.File) {
-	command := strings.Join(comArray, " ")
-	log.Infof("Send init command: %s", command)
-	_, _ = writePipe.WriteString(command)
-	_ = writePipe.Close()
+// prepareCgroup creates the cgroup and sets the resource limits
+func prepareCgroup(manager *container.CgroupsManager, name string, res *cgroups.ResourceConfig) error {
+	if err := manager.CreateCgroup(name); err != nil {
+		return fmt.Errorf("failed to create cgroup %s: %v", name, err)
+	}
+	if err := manager.Set(name, res); err != nil {
+		return fmt.Errorf("failed to set cgroup %s: %v", name, err)
+	}
+	return nil
+}
+
+// cloneCommand copies a command which failed to start, so that it can be started again
+func cloneCommand(cmd *exec.Cmd) *exec.Cmd {
+	clone := exec.Command(cmd.Path, cmd.Args[1:]...)
+	clone.Dir = cmd.Dir
+	clone.Env = cmd.Env
+	clone.Stdin = cmd.Stdin
+	clone.Stdout = cmd.Stdout
+	clone.Stderr = cmd.Stderr
+	clone.ExtraFiles = cmd.ExtraFiles
+	attr := *cmd.SysProcAttr
+	clone.SysProcAttr = &attr
+	return clone
+}
+
+// killProcess kills a started container process which must not run, and reaps it
+func killProcess(process *exec.Cmd) {
+	if err := process.Process.Kill(); err != nil {
+		log.Errorf("Failed to kill process %d: %v", process.Process.Pid, err)
+	}
+	_ = process.Wait()
 }
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	container "minidocker/container"
+	image "minidocker/image"
+)
+
+// defaultPath is the PATH of containers whose image sets none
+const defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+/**
+ * @Description: ProcessOptions overrides the image config for the container command
+ * @param Entrypoint replaces the image entrypoint when not nil, an empty string clears it
+ * @param Env environment variables, KEY=VALUE or KEY to pass the host value on
+ * @param WorkingDir working directory of the command
+ * @param User user[:group] or uid[:gid] the command runs as
+ */
+type ProcessOptions struct {
+	Entrypoint *string
+	Env        []string
+	WorkingDir string
+	User       string
+}
+
+/**
+ * @Description: buildInitSpec merges the image config with the command line like docker:
+ *	the arguments replace Cmd, --entrypoint replaces Entrypoint and drops Cmd,
+ *	-e overrides Env by key, -w and -u replace WorkingDir and User
+ * @param config image config, may be nil
+ * @param args command line arguments after the image
+ * @param opts command line overrides
+ * @return *container.InitSpec, error
+ */
+func buildInitSpec(config *image.Config, args []string, opts *ProcessOptions) (*container.InitSpec, error) {
+	if config == nil {
+		config = &image.Config{}
+	}
+
+	entrypoint, cmd := config.Entrypoint, config.Cmd
+	if opts.Entrypoint != nil {
+		entrypoint, cmd = nil, nil
+		if *opts.Entrypoint != "" {
+			entrypoint = []string{*opts.Entrypoint}
+		}
+	}
+	if len(args) > 0 {
+		cmd = args
+	}
+
+	spec := &container.InitSpec{
+		Args: append(append([]string{}, entrypoint...), cmd...),
+		Cwd:  config.WorkingDir,
+		User: config.User,
+	}
+	if len(spec.Args) == 0 {
+		return nil, fmt.Errorf("no command specified and the image has no Cmd or Entrypoint")
+	}
+	if opts.WorkingDir != "" {
+		spec.Cwd = opts.WorkingDir
+	}
+	if spec.Cwd == "" {
+		spec.Cwd = "/"
+	}
+	if !strings.HasPrefix(spec.Cwd, "/") {
+		return nil, fmt.Errorf("working dir %s must be an absolute path", spec.Cwd)
+	}
+	if opts.User != "" {
+		spec.User = opts.User
+	}
+
+	env, err := mergeEnv(config.Env, opts.Env)
+	if err != nil {
+		return nil, err
+	}
+	spec.Env = env
+	return spec, nil
+}
+
+// mergeEnv overrides the image env with the command line env by key, keeping the image order
+func mergeEnv(imageEnv []string, overrides []string) ([]string, error) {
+	env := append([]string{}, imageEnv...)
+	index := make(map[string]int)
+	for i, entry := range env {
+		key, _, _ := strings.Cut(entry, "=")
+		index[key] = i
+	}
+
+	for _, entry := range overrides {
+		key, _, hasValue := strings.Cut(entry, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid env [%s], must be KEY=VALUE or KEY", entry)
+		}
+		if !hasValue {
+			// KEY alone passes the host value on, or nothing when the host has none
+			value, ok := os.LookupEnv(key)
+			if !ok {
+				continue
+			}
+			entry = key + "=" + value
+		}
+		if i, ok := index[key]; ok {
+			env[i] = entry
+		} else {
+			index[key] = len(env)
+			env = append(env, entry)
+		}
+	}
+
+	if _, ok := index["PATH"]; !ok {
+		env = append(env, defaultPath)
+	}
+	return env, nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeEnv(t *testing.T) {
+	t.Setenv("MINIDOCKER_TEST_HOST", "host")
+
+	tests := []struct {
+		name      string
+		imageEnv  []string
+		overrides []string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name: "default path",
+			want: []string{defaultPath},
+		},
+		{
+			name:     "image env",
+			imageEnv: []string{"PATH=/bin", "A=1"},
+			want:     []string{"PATH=/bin", "A=1"},
+		},
+		{
+			name:      "override keeps the image order",
+			imageEnv:  []string{"A=1", "PATH=/bin", "B=2"},
+			overrides: []string{"B=3", "C=4", "A="},
+			want:      []string{"A=", "PATH=/bin", "B=3", "C=4"},
+		},
+		{
+			name:      "later override wins",
+			imageEnv:  []string{"PATH=/bin"},
+			overrides: []string{"A=1", "A=2"},
+			want:      []string{"PATH=/bin", "A=2"},
+		},
+		{
+			name:      "value with equals sign",
+			imageEnv:  []string{"PATH=/bin"},
+			overrides: []string{"OPTS=a=b"},
+			want:      []string{"PATH=/bin", "OPTS=a=b"},
+		},
+		{
+			name:      "host value",
+			imageEnv:  []string{"PATH=/bin", "MINIDOCKER_TEST_HOST=image"},
+			overrides: []string{"MINIDOCKER_TEST_HOST", "MINIDOCKER_TEST_UNSET"},
+			want:      []string{"PATH=/bin", "MINIDOCKER_TEST_HOST=host"},
+		},
+		{
+			name:      "path override",
+			overrides: []string{"PATH=/opt/bin"},
+			want:      []string{"PATH=/opt/bin"},
+		},
+		{
+			name:      "empty key",
+			overrides: []string{"=1"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		imageEnv := append([]string(nil), tt.imageEnv...)
+		got, err := mergeEnv(tt.imageEnv, tt.overrides)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: mergeEnv() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mergeEnv() = %q, want %q", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(tt.imageEnv, imageEnv) {
+			t.Errorf("%s: mergeEnv() modified the image env: %q", tt.name, tt.imageEnv)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BlkioControllerV1 translates the resource configuration to the cgroup v1 blkio hierarchy
+type BlkioControllerV1 struct{}
+
+func (bs *BlkioControllerV1) Name() string {
+	return "blkio"
+}
+
+func (bs *BlkioControllerV1) Subsystems() []string {
+	return []string{"blkio"}
+}
+
+// Set sets the resource configuration to the path
+func (bs *BlkioControllerV1) Set(path string, res *ResourceConfig) error {
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	// Set blkio.weight, which ranges from 10 to 1000 instead of 1 to 10000
+	if res.BlkioWeight != "" {
+		weight, _ := strconv.ParseUint(res.BlkioWeight, 10, 64)
+		value := strconv.FormatUint(10+(weight-1)*990/9999, 10)
+		if err := writeToFile(filepath.Join(path, "blkio.weight"), value); err != nil {
+			return fmt.Errorf("failed to set blkio.weight: %v", err)
+		}
+		log.Infof("Set blkio.weight: %s", value)
+	}
+
+	// Set blkio.throttle.*_device, one line per device
+	throttles := []struct {
+		file  string
+		specs []string
+	}{
+		{"blkio.throttle.read_bps_device", res.DeviceReadBps},
+		{"blkio.throttle.write_bps_device", res.DeviceWriteBps},
+		{"blkio.throttle.read_iops_device", res.DeviceReadIops},
+		{"blkio.throttle.write_iops_device", res.DeviceWriteIops},
+	}
+	for _, throttle := range throttles {
+		for _, spec := range throttle.specs {
+			device, value, err := parseDeviceValue(spec)
+			if err != nil {
+				return err
+			}
+			major, minor, err := deviceNumber(device)
+			if err != nil {
+				return err
+			}
+			// 0 removes the limit in cgroup v1
+			if value == "max" {
+				value = "0"
+			}
+			line := fmt.Sprintf("%d:%d %s", major, minor, value)
+			if err := writeToFile(filepath.Join(path, throttle.file), line); err != nil {
+				return fmt.Errorf("failed to set %s: %v", throttle.file, err)
+			}
+			log.Infof("Set %s: %s", throttle.file, line)
+		}
+	}
+
+	return nil
+}
+
+// GetStats reads blkio.throttle.io_service_bytes and blkio.throttle.io_serviced from the path
+func (bs *BlkioControllerV1) GetStats(path string, stats *Stats) error {
+	devices := make(map[string]*IODeviceStats)
+	var order []string
+
+	// e.g. 8:0 Read 90112
+	parse := func(file string, read, write func(*IODeviceStats, uint64)) error {
+		data, err := readFromFile(filepath.Join(path, file))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		for _, line := range strings.Split(data, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			n, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s in %s: %v", line, file, err)
+			}
+			entry, ok := devices[fields[0]]
+			if !ok {
+				entry = &IODeviceStats{}
+				if _, err := fmt.Sscanf(fields[0], "%d:%d", &entry.Major, &entry.Minor); err != nil {
+					return fmt.Errorf("failed to parse device %s in %s: %v", fields[0], file, err)
+				}
+				devices[fields[0]] = entry
+				order = append(order, fields[0])
+			}
+			switch fields[1] {
+			case "Read":
+				read(entry, n)
+			case "Write":
+				write(entry, n)
+			}
+		}
+		return nil
+	}
+
+	if err := parse("blkio.throttle.io_service_bytes",
+		func(e *IODeviceStats, n uint64) { e.ReadBytes = n },
+		func(e *IODeviceStats, n uint64) { e.WriteBytes = n }); err != nil {
+		return err
+	}
+	if err := parse("blkio.throttle.io_serviced",
+		func(e *IODeviceStats, n uint64) { e.ReadIOs = n },
+		func(e *IODeviceStats, n uint64) { e.WriteIOs = n }); err != nil {
+		return err
+	}
+
+	for _, device := range order {
+		stats.IO.Devices = append(stats.IO.Devices, *devices[device])
+	}
+	return nil
+}
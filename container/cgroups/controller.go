@@ -1,27 +1,77 @@
 package cgroups
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 )
 
 /**
  * @Description: ResourceConfig is a struct to store resource configuration
  * @param MemoryLimit memory limit, how much memory can be used
+ * @param MemoryOomGroup kill all processes of the cgroup together on OOM
  * @param CpuCfsQuota cpu cfs quota, how much cpu time can be used in a time slice
+ * @param Cpus number of cpus that can be used, an alternative to CpuMax
+ * @param CpuPeriod length of the cpu cfs period in microseconds
  * @param CpuShare cpu share, how much cpu time can be used in a period
  * @param CpuSet cpu set, which cpu can be used
+ * @param CpuSetMems memory nodes, which NUMA node can be used
+ * @param CpuSetPartition makes CpuSet an exclusive cpu partition when root or isolated
+ * @param PidsMax max number of processes in the cgroup
+ * @param BlkioWeight io weight of the cgroup, from 1 to 10000
+ * @param DeviceReadBps read bytes per second limit per device
+ * @param DeviceWriteBps write bytes per second limit per device
+ * @param DeviceReadIops read io per second limit per device
+ * @param DeviceWriteIops write io per second limit per device
+ * @param HugetlbLimits huge page usage limit per page size
  */
 type ResourceConfig struct {
-	MemoryMin     string
-	MemoryMax     string
-	MemorySwapMax string
-	MemoryLow     string
-	MemoryHigh    string
-	CpuMax        string
-	CpuWeight     string
-	CpuWeightNice string
-	CpuSet        string
+	MemoryMin       string
+	MemoryMax       string
+	MemorySwapMax   string
+	MemoryLow       string
+	MemoryHigh      string
+	MemoryOomGroup  bool
+	CpuMax          string
+	Cpus            string
+	CpuPeriod       string
+	CpuWeight       string
+	CpuWeightNice   string
+	CpuSet          string
+	CpuSetMems      string
+	CpuSetPartition string
+	PidsMax         string
+	BlkioWeight     string
+	// Device limits have the form "<device>:<value>", e.g. /dev/sda:1048576
+	DeviceReadBps   []string
+	DeviceWriteBps  []string
+	DeviceReadIops  []string
+	DeviceWriteIops []string
+	// Hugetlb limits have the form "<pagesize>:<limit>", e.g. 2MB:536870912
+	HugetlbLimits []string
+}
+
+// IsEmpty reports whether no resource limit is configured, unset slice flags are empty but not nil
+func (res *ResourceConfig) IsEmpty() bool {
+	for _, value := range []string{
+		res.MemoryMin, res.MemoryMax, res.MemorySwapMax, res.MemoryLow, res.MemoryHigh,
+		res.CpuMax, res.Cpus, res.CpuPeriod, res.CpuWeight, res.CpuWeightNice,
+		res.CpuSet, res.CpuSetMems, res.CpuSetPartition, res.PidsMax, res.BlkioWeight,
+	} {
+		if value != "" {
+			return false
+		}
+	}
+	for _, list := range [][]string{
+		res.DeviceReadBps, res.DeviceWriteBps, res.DeviceReadIops, res.DeviceWriteIops, res.HugetlbLimits,
+	} {
+		if len(list) > 0 {
+			return false
+		}
+	}
+	return !res.MemoryOomGroup
 }
 
 /**
@@ -33,6 +83,12 @@ type Controller interface {
 	 */
 	Name() string
 
+	/**
+	 * @Description: Subsystems returns the cgroup v2 controllers that must be
+	 *	enabled in the parent's cgroup.subtree_control before Set is called
+	 */
+	Subsystems() []string
+
 	/**
 	 * @Description: Set sets the resource configuration to the path
 	 * @param path path to the cgroup
@@ -40,6 +96,14 @@ type Controller interface {
 	 * @return error
 	 */
 	Set(path string, res *ResourceConfig) error
+
+	/**
+	 * @Description: GetStats reads the resource usage of the path into stats
+	 * @param path path to the cgroup
+	 * @param stats stats to fill
+	 * @return error
+	 */
+	GetStats(path string, stats *Stats) error
 }
 
 // Helper function to write data to a file
@@ -54,8 +118,58 @@ func writeToFile(filePath string, value string) error {
 	// Write value
 	_, err = file.WriteString(value + "\n")
 	if err != nil {
-		return fmt.Errorf("failed to write to file %s: %v", filePath, err)
+		return fmt.Errorf("failed to write to file %s: %w", filePath, err)
 	}
 
 	return nil
 }
+
+// Helper function to read a file and trim the trailing newline
+func readFromFile(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %v", filePath, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Helper function to read a single value file, e.g. pids.current.
+// "max" is reported as 0 to mean unlimited.
+func readUint64File(filePath string) (uint64, error) {
+	value, err := readFromFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// Helper function to read a flat keyed file, e.g. cpu.stat or pids.events.
+// Each line has the form "<key> <value>".
+func readKeyValueFile(filePath string) (map[string]uint64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s in %s: %v", fields[0], filePath, err)
+		}
+		values[fields[0]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %v", filePath, err)
+	}
+	return values, nil
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -14,6 +16,10 @@ func (cs *CPUController) Name() string {
 	return "cpu"
 }
 
+func (cs *CPUController) Subsystems() []string {
+	return []string{"cpu", "cpuset"}
+}
+
 // Set sets the resource configuration to the path
 func (cs *CPUController) Set(path string, res *ResourceConfig) error {
 	// Ensure the path exists
@@ -23,10 +29,19 @@ func (cs *CPUController) Set(path string, res *ResourceConfig) error {
 
 	// Set cpu.max
 	if res.CpuMax != "" {
-		if err := writeToFile(filepath.Join(path, "cpu.max"), res.CpuMax + " 100000"); err != nil {
+		if err := writeToFile(filepath.Join(path, "cpu.max"), res.CpuMax); err != nil {
 			return fmt.Errorf("failed to set cpu.max: %v", err)
 		}
-		log.Infof("Set cpu.max: %s", res.CpuMax)
+		// Read back what the kernel actually applied
+		quota, period, err := readCPUMax(filepath.Join(path, "cpu.max"))
+		if err != nil {
+			return fmt.Errorf("failed to read back cpu.max: %v", err)
+		}
+		if quota == 0 {
+			log.Infof("Set cpu.max: max, period %dus", period)
+		} else {
+			log.Infof("Set cpu.max: quota %dus, period %dus (%.2f cpus)", quota, period, float64(quota)/float64(period))
+		}
 	}
 
 	// Set cpu.weight
@@ -47,11 +62,140 @@ func (cs *CPUController) Set(path string, res *ResourceConfig) error {
 
 	// Set cpuset.cpus
 	if res.CpuSet != "" {
+		if err := checkSubset(filepath.Join(filepath.Dir(path), "cpuset.cpus.effective"), res.CpuSet); err != nil {
+			return fmt.Errorf("invalid cpuset: %v", err)
+		}
 		if err := writeToFile(filepath.Join(path, "cpuset.cpus"), res.CpuSet); err != nil {
 			return fmt.Errorf("failed to set cpuset.cpus: %v", err)
 		}
 		log.Infof("Set cpuset.cpus: %s", res.CpuSet)
 	}
 
+	// Set cpuset.mems
+	if res.CpuSetMems != "" {
+		if err := checkSubset(filepath.Join(filepath.Dir(path), "cpuset.mems.effective"), res.CpuSetMems); err != nil {
+			return fmt.Errorf("invalid cpuset-mems: %v", err)
+		}
+		if err := writeToFile(filepath.Join(path, "cpuset.mems"), res.CpuSetMems); err != nil {
+			return fmt.Errorf("failed to set cpuset.mems: %v", err)
+		}
+		log.Infof("Set cpuset.mems: %s", res.CpuSetMems)
+	}
+
+	// Set cpuset.cpus.partition, must come after cpuset.cpus
+	if res.CpuSetPartition != "" {
+		// a member, the default, needs no partition root above it
+		if res.CpuSetPartition != "member" {
+			if err := checkPartitionParent(filepath.Dir(path)); err != nil {
+				return fmt.Errorf("failed to set cpuset.cpus.partition to %s: %v", res.CpuSetPartition, err)
+			}
+		}
+		partitionFile := filepath.Join(path, "cpuset.cpus.partition")
+		if err := writeToFile(partitionFile, res.CpuSetPartition); err != nil {
+			return fmt.Errorf("failed to set cpuset.cpus.partition: %v", err)
+		}
+		// An invalid partition is accepted by the write and reported on read,
+		// e.g. "root invalid (Parent is not a partition root)"
+		state, err := readFromFile(partitionFile)
+		if err != nil {
+			return fmt.Errorf("failed to read back cpuset.cpus.partition: %v", err)
+		}
+		if state != res.CpuSetPartition {
+			return fmt.Errorf("failed to set cpuset.cpus.partition to %s: %s", res.CpuSetPartition, state)
+		}
+		log.Infof("Set cpuset.cpus.partition: %s", state)
+	}
+
 	return nil
-}
\ No newline at end of file
+}
+
+// checkPartitionParent checks that the parent cgroup is a valid partition root,
+// the kernel only lets a child of a partition root become a partition itself
+func checkPartitionParent(parent string) error {
+	partitionFile := filepath.Join(parent, "cpuset.cpus.partition")
+	if _, err := os.Stat(partitionFile); os.IsNotExist(err) {
+		// the root cgroup has no partition file and is always a partition root
+		return nil
+	}
+	state, err := readFromFile(partitionFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the partition of the parent cgroup: %v", err)
+	}
+	if state != "root" && state != "isolated" {
+		return fmt.Errorf("parent cgroup %s is not a partition root (%s), make it one or use a -cgroup-parent which is", parent, state)
+	}
+	return nil
+}
+
+// checkSubset checks that every member of list is in the list stored in effectiveFile
+func checkSubset(effectiveFile string, list string) error {
+	data, err := readFromFile(effectiveFile)
+	if err != nil {
+		return err
+	}
+	effective, err := parseList(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", effectiveFile, err)
+	}
+	requested, err := parseList(list)
+	if err != nil {
+		return err
+	}
+	for member := range requested {
+		if _, ok := effective[member]; !ok {
+			return fmt.Errorf("%d is not in the parent's effective set %s", member, data)
+		}
+	}
+	return nil
+}
+
+// GetStats reads cpu.stat from the path
+func (cs *CPUController) GetStats(path string, stats *Stats) error {
+	values, err := readKeyValueFile(filepath.Join(path, "cpu.stat"))
+	if err != nil {
+		return fmt.Errorf("failed to read cpu.stat: %v", err)
+	}
+	stats.CPU.UsageUsec = values["usage_usec"]
+	stats.CPU.UserUsec = values["user_usec"]
+	stats.CPU.SystemUsec = values["system_usec"]
+	stats.CPU.NrPeriods = values["nr_periods"]
+	stats.CPU.NrThrottled = values["nr_throttled"]
+	stats.CPU.ThrottledUsec = values["throttled_usec"]
+
+	quota, period, err := readCPUMax(filepath.Join(path, "cpu.max"))
+	if err != nil {
+		return fmt.Errorf("failed to read cpu.max: %v", err)
+	}
+	stats.CPU.Quota = quota
+	stats.CPU.Period = period
+
+	pressure, err := readPressure(path, "cpu")
+	if err != nil {
+		return fmt.Errorf("failed to read cpu.pressure: %v", err)
+	}
+	stats.CPU.Pressure = *pressure
+	return nil
+}
+
+// readCPUMax reads "<quota> <period>" from cpu.max, a quota of "max" is reported as 0
+func readCPUMax(filePath string) (uint64, uint64, error) {
+	data, err := readFromFile(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(data)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected cpu.max content: %s", data)
+	}
+	var quota uint64
+	if fields[0] != "max" {
+		if quota, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	period, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return quota, period, nil
+}
@@ -0,0 +1,84 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CPUControllerV1 translates the resource configuration to the cgroup v1 cpu hierarchy
+type CPUControllerV1 struct{}
+
+func (cs *CPUControllerV1) Name() string {
+	return "cpu"
+}
+
+func (cs *CPUControllerV1) Subsystems() []string {
+	return []string{"cpu"}
+}
+
+// Set sets the resource configuration to the path
+func (cs *CPUControllerV1) Set(path string, res *ResourceConfig) error {
+	if res.CpuWeightNice != "" {
+		return fmt.Errorf("cpu-weight-nice is not supported on cgroup v1")
+	}
+
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	// Set cpu.cfs_period_us and cpu.cfs_quota_us from "<quota> <period>"
+	if res.CpuMax != "" {
+		fields := strings.Fields(res.CpuMax)
+		if err := writeToFile(filepath.Join(path, "cpu.cfs_period_us"), fields[1]); err != nil {
+			return fmt.Errorf("failed to set cpu.cfs_period_us: %v", err)
+		}
+		if err := writeToFile(filepath.Join(path, "cpu.cfs_quota_us"), v1Limit(fields[0])); err != nil {
+			return fmt.Errorf("failed to set cpu.cfs_quota_us: %v", err)
+		}
+		log.Infof("Set cpu.cfs_quota_us: %s, cpu.cfs_period_us: %s", fields[0], fields[1])
+	}
+
+	// Set cpu.shares
+	if res.CpuWeight != "" {
+		weight, _ := strconv.ParseUint(res.CpuWeight, 10, 64)
+		shares := strconv.FormatUint(weightToShares(weight), 10)
+		if err := writeToFile(filepath.Join(path, "cpu.shares"), shares); err != nil {
+			return fmt.Errorf("failed to set cpu.shares: %v", err)
+		}
+		log.Infof("Set cpu.shares: %s", shares)
+	}
+
+	return nil
+}
+
+// GetStats reads cpu.stat, cpu.cfs_quota_us and cpu.cfs_period_us from the path
+func (cs *CPUControllerV1) GetStats(path string, stats *Stats) error {
+	values, err := readKeyValueFile(filepath.Join(path, "cpu.stat"))
+	if err != nil {
+		return fmt.Errorf("failed to read cpu.stat: %v", err)
+	}
+	stats.CPU.NrPeriods = values["nr_periods"]
+	stats.CPU.NrThrottled = values["nr_throttled"]
+	// throttled_time is in nanoseconds
+	stats.CPU.ThrottledUsec = values["throttled_time"] / 1000
+
+	// cpu.cfs_quota_us is -1 when unlimited
+	if quota, err := readFromFile(filepath.Join(path, "cpu.cfs_quota_us")); err == nil && quota != "-1" {
+		stats.CPU.Quota, _ = strconv.ParseUint(quota, 10, 64)
+	}
+	if period, err := readUint64File(filepath.Join(path, "cpu.cfs_period_us")); err == nil {
+		stats.CPU.Period = period
+	}
+	return nil
+}
+
+// weightToShares converts cpu.weight [1, 10000] to cpu.shares [2, 262144]
+func weightToShares(weight uint64) uint64 {
+	return 2 + ((weight-1)*262142)/9999
+}
@@ -0,0 +1,44 @@
+package cgroups
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Clock ticks per second of cpuacct.stat, USER_HZ is 100 on all mainstream architectures
+const userHZ = 100
+
+// CpuacctControllerV1 reports the cpu usage from the cgroup v1 cpuacct hierarchy
+type CpuacctControllerV1 struct{}
+
+func (cs *CpuacctControllerV1) Name() string {
+	return "cpuacct"
+}
+
+func (cs *CpuacctControllerV1) Subsystems() []string {
+	return []string{"cpuacct"}
+}
+
+// Set does nothing, cpuacct only accounts
+func (cs *CpuacctControllerV1) Set(path string, res *ResourceConfig) error {
+	return nil
+}
+
+// GetStats reads cpuacct.usage and cpuacct.stat from the path
+func (cs *CpuacctControllerV1) GetStats(path string, stats *Stats) error {
+	// cpuacct.usage is in nanoseconds
+	usage, err := readUint64File(filepath.Join(path, "cpuacct.usage"))
+	if err != nil {
+		return fmt.Errorf("failed to read cpuacct.usage: %v", err)
+	}
+	stats.CPU.UsageUsec = usage / 1000
+
+	// cpuacct.stat is in clock ticks
+	values, err := readKeyValueFile(filepath.Join(path, "cpuacct.stat"))
+	if err != nil {
+		return fmt.Errorf("failed to read cpuacct.stat: %v", err)
+	}
+	stats.CPU.UserUsec = values["user"] * 1000000 / userHZ
+	stats.CPU.SystemUsec = values["system"] * 1000000 / userHZ
+	return nil
+}
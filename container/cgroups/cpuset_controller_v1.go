@@ -0,0 +1,95 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CpusetControllerV1 translates the resource configuration to the cgroup v1 cpuset hierarchy
+type CpusetControllerV1 struct{}
+
+func (cs *CpusetControllerV1) Name() string {
+	return "cpuset"
+}
+
+func (cs *CpusetControllerV1) Subsystems() []string {
+	return []string{"cpuset"}
+}
+
+// Set sets the resource configuration to the path
+func (cs *CpusetControllerV1) Set(path string, res *ResourceConfig) error {
+	if res.CpuSetPartition != "" && res.CpuSetPartition != "member" {
+		return fmt.Errorf("cpuset-partition is not supported on cgroup v1")
+	}
+
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	// A v1 cpuset with empty cpus or mems can not hold any process,
+	// so inherit them from the parent first.
+	for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+		if err := inheritCpuset(path, file); err != nil {
+			return err
+		}
+	}
+
+	// Set cpuset.cpus
+	if res.CpuSet != "" {
+		if err := checkSubset(filepath.Join(filepath.Dir(path), "cpuset.effective_cpus"), res.CpuSet); err != nil {
+			return fmt.Errorf("invalid cpuset: %v", err)
+		}
+		if err := writeToFile(filepath.Join(path, "cpuset.cpus"), res.CpuSet); err != nil {
+			return fmt.Errorf("failed to set cpuset.cpus: %v", err)
+		}
+		log.Infof("Set cpuset.cpus: %s", res.CpuSet)
+	}
+
+	// Set cpuset.mems
+	if res.CpuSetMems != "" {
+		if err := checkSubset(filepath.Join(filepath.Dir(path), "cpuset.effective_mems"), res.CpuSetMems); err != nil {
+			return fmt.Errorf("invalid cpuset-mems: %v", err)
+		}
+		if err := writeToFile(filepath.Join(path, "cpuset.mems"), res.CpuSetMems); err != nil {
+			return fmt.Errorf("failed to set cpuset.mems: %v", err)
+		}
+		log.Infof("Set cpuset.mems: %s", res.CpuSetMems)
+	}
+
+	return nil
+}
+
+// GetStats does nothing, cpuset has no usage to report
+func (cs *CpusetControllerV1) GetStats(path string, stats *Stats) error {
+	return nil
+}
+
+// inheritCpuset copies file from the closest ancestor which has it set,
+// filling every empty cpuset on the way down to path
+func inheritCpuset(path string, file string) error {
+	value, err := readFromFile(filepath.Join(path, file))
+	if err != nil {
+		// Reached the top of the hierarchy
+		return err
+	}
+	if value != "" {
+		return nil
+	}
+
+	parent := filepath.Dir(path)
+	if err := inheritCpuset(parent, file); err != nil {
+		return err
+	}
+	value, err = readFromFile(filepath.Join(parent, file))
+	if err != nil {
+		return err
+	}
+	if err := writeToFile(filepath.Join(path, file), value); err != nil {
+		return fmt.Errorf("failed to inherit %s: %v", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package cgroups
+
+// FreezerControllerV1 joins the cgroup v1 freezer hierarchy, which is used to
+// stop all processes of a container atomically during teardown
+type FreezerControllerV1 struct{}
+
+func (fs *FreezerControllerV1) Name() string {
+	return "freezer"
+}
+
+func (fs *FreezerControllerV1) Subsystems() []string {
+	return []string{"freezer"}
+}
+
+// Set does nothing, the freezer has no limits
+func (fs *FreezerControllerV1) Set(path string, res *ResourceConfig) error {
+	return nil
+}
+
+// GetStats does nothing, the freezer has no usage to report
+func (fs *FreezerControllerV1) GetStats(path string, stats *Stats) error {
+	return nil
+}
@@ -0,0 +1,131 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type HugetlbController struct{}
+
+func (hs *HugetlbController) Name() string {
+	return "hugetlb"
+}
+
+func (hs *HugetlbController) Subsystems() []string {
+	return []string{"hugetlb"}
+}
+
+// Set sets the resource configuration to the path
+func (hs *HugetlbController) Set(path string, res *ResourceConfig) error {
+	if len(res.HugetlbLimits) == 0 {
+		return nil
+	}
+
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	supported, err := hugePageSizes(path, "max")
+	if err != nil {
+		return err
+	}
+
+	// Set hugetlb.<size>.max
+	for _, limit := range res.HugetlbLimits {
+		size, value, _ := strings.Cut(limit, ":")
+		if err := checkPageSize(path, size, supported); err != nil {
+			return err
+		}
+		if err := writeToFile(filepath.Join(path, "hugetlb."+size+".max"), value); err != nil {
+			return fmt.Errorf("failed to set hugetlb.%s.max: %v", size, err)
+		}
+		log.Infof("Set hugetlb.%s.max: %s", size, value)
+	}
+
+	return nil
+}
+
+// GetStats reads hugetlb.<size>.current, hugetlb.<size>.max and hugetlb.<size>.events from the path
+func (hs *HugetlbController) GetStats(path string, stats *Stats) error {
+	sizes, err := hugePageSizes(path, "max")
+	if err != nil {
+		return err
+	}
+
+	for _, size := range sizes {
+		prefix := filepath.Join(path, "hugetlb."+size)
+		usage, err := readUint64File(prefix + ".current")
+		if err != nil {
+			return fmt.Errorf("failed to read hugetlb.%s.current: %v", size, err)
+		}
+		entry := HugetlbStats{Usage: usage}
+		if limit, err := readUint64File(prefix + ".max"); err == nil {
+			entry.Limit = limit
+		}
+		if events, err := readKeyValueFile(prefix + ".events"); err == nil {
+			entry.MaxEvents = events["max"]
+		}
+		if stats.Hugetlb == nil {
+			stats.Hugetlb = make(map[string]HugetlbStats)
+		}
+		stats.Hugetlb[size] = entry
+	}
+	return nil
+}
+
+// hugePageSizes discovers the page sizes from the hugetlb.<size>.<file> files of the path,
+// e.g. max on cgroup v2 or limit_in_bytes on v1
+func hugePageSizes(path string, file string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(path, "hugetlb.*."+file))
+	if err != nil {
+		return nil, err
+	}
+	var sizes []string
+	for _, f := range files {
+		// hugetlb.2MB.max, but not hugetlb.2MB.rsvd.max
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "hugetlb."), "."+file)
+		if !strings.Contains(name, ".") {
+			sizes = append(sizes, name)
+		}
+	}
+	return sizes, nil
+}
+
+// checkPageSize checks the cgroup at path has a limit for the page size
+func checkPageSize(path string, size string, supported []string) error {
+	if len(supported) == 0 {
+		return fmt.Errorf("hugetlb controller is not available in %s", path)
+	}
+	for _, s := range supported {
+		if s == size {
+			return nil
+		}
+	}
+	return fmt.Errorf("huge page size %s is not supported, supported sizes: %s", size, strings.Join(supported, ", "))
+}
+
+// pageSizeName converts a page size to the name used by the kernel, e.g. 2097152 gives 2MB
+func pageSizeName(value string) (string, error) {
+	bytesStr, err := ParseBytes(value)
+	if err != nil || bytesStr == "max" {
+		return "", fmt.Errorf("invalid huge page size [%s], e.g. 2MB or 1GB", value)
+	}
+	bytes, _ := strconv.ParseUint(bytesStr, 10, 64)
+	switch {
+	case bytes == 0:
+		return "", fmt.Errorf("invalid huge page size [%s], e.g. 2MB or 1GB", value)
+	case bytes%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", bytes>>30), nil
+	case bytes%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", bytes>>20), nil
+	case bytes%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", bytes>>10), nil
+	}
+	return "", fmt.Errorf("invalid huge page size [%s], must be a multiple of 1KB", value)
+}
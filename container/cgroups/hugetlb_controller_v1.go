@@ -0,0 +1,81 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HugetlbControllerV1 translates the resource configuration to the cgroup v1 hugetlb hierarchy
+type HugetlbControllerV1 struct{}
+
+func (hs *HugetlbControllerV1) Name() string {
+	return "hugetlb"
+}
+
+func (hs *HugetlbControllerV1) Subsystems() []string {
+	return []string{"hugetlb"}
+}
+
+// Set sets the resource configuration to the path
+func (hs *HugetlbControllerV1) Set(path string, res *ResourceConfig) error {
+	if len(res.HugetlbLimits) == 0 {
+		return nil
+	}
+
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	supported, err := hugePageSizes(path, "limit_in_bytes")
+	if err != nil {
+		return err
+	}
+
+	// Set hugetlb.<size>.limit_in_bytes, same page size names as cgroup v2
+	for _, limit := range res.HugetlbLimits {
+		size, value, _ := strings.Cut(limit, ":")
+		if err := checkPageSize(path, size, supported); err != nil {
+			return err
+		}
+		if err := writeToFile(filepath.Join(path, "hugetlb."+size+".limit_in_bytes"), v1Limit(value)); err != nil {
+			return fmt.Errorf("failed to set hugetlb.%s.limit_in_bytes: %v", size, err)
+		}
+		log.Infof("Set hugetlb.%s.limit_in_bytes: %s", size, value)
+	}
+
+	return nil
+}
+
+// GetStats reads hugetlb.<size>.usage_in_bytes, hugetlb.<size>.limit_in_bytes and hugetlb.<size>.failcnt from the path
+func (hs *HugetlbControllerV1) GetStats(path string, stats *Stats) error {
+	sizes, err := hugePageSizes(path, "limit_in_bytes")
+	if err != nil {
+		return err
+	}
+
+	for _, size := range sizes {
+		prefix := filepath.Join(path, "hugetlb."+size)
+		usage, err := readUint64File(prefix + ".usage_in_bytes")
+		if err != nil {
+			return fmt.Errorf("failed to read hugetlb.%s.usage_in_bytes: %v", size, err)
+		}
+		entry := HugetlbStats{Usage: usage}
+		if limit, err := readUint64File(prefix + ".limit_in_bytes"); err == nil {
+			entry.Limit = limit
+		}
+		// failcnt counts the allocations which hit the limit, like the max event of v2
+		if failcnt, err := readUint64File(prefix + ".failcnt"); err == nil {
+			entry.MaxEvents = failcnt
+		}
+		if stats.Hugetlb == nil {
+			stats.Hugetlb = make(map[string]HugetlbStats)
+		}
+		stats.Hugetlb[size] = entry
+	}
+	return nil
+}
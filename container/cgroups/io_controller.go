@@ -0,0 +1,187 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+type IOController struct{}
+
+func (is *IOController) Name() string {
+	return "io"
+}
+
+func (is *IOController) Subsystems() []string {
+	return []string{"io"}
+}
+
+// Set sets the resource configuration to the path
+func (is *IOController) Set(path string, res *ResourceConfig) error {
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	// Set io.weight
+	if res.BlkioWeight != "" {
+		if err := writeToFile(filepath.Join(path, "io.weight"), "default "+res.BlkioWeight); err != nil {
+			return fmt.Errorf("failed to set io.weight: %v", err)
+		}
+		log.Infof("Set io.weight: %s", res.BlkioWeight)
+	}
+
+	// Set io.max, one line per device
+	limits, err := parseIOLimits(res)
+	if err != nil {
+		return err
+	}
+	for _, limit := range limits {
+		if err := writeToFile(filepath.Join(path, "io.max"), limit.String()); err != nil {
+			return fmt.Errorf("failed to set io.max: %v", err)
+		}
+		log.Infof("Set io.max: %s", limit)
+	}
+
+	return nil
+}
+
+// GetStats reads io.stat from the path
+func (is *IOController) GetStats(path string, stats *Stats) error {
+	data, err := readFromFile(filepath.Join(path, "io.stat"))
+	if err != nil {
+		return fmt.Errorf("failed to read io.stat: %v", err)
+	}
+
+	// e.g. 8:0 rbytes=90112 wbytes=0 rios=3 wios=0 dbytes=0 dios=0
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entry := IODeviceStats{}
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &entry.Major, &entry.Minor); err != nil {
+			return fmt.Errorf("failed to parse device %s in io.stat: %v", fields[0], err)
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s in io.stat: %v", field, err)
+			}
+			switch key {
+			case "rbytes":
+				entry.ReadBytes = n
+			case "wbytes":
+				entry.WriteBytes = n
+			case "rios":
+				entry.ReadIOs = n
+			case "wios":
+				entry.WriteIOs = n
+			case "dbytes":
+				entry.DiscardBytes = n
+			case "dios":
+				entry.DiscardIOs = n
+			}
+		}
+		stats.IO.Devices = append(stats.IO.Devices, entry)
+	}
+
+	pressure, err := readPressure(path, "io")
+	if err != nil {
+		return fmt.Errorf("failed to read io.pressure: %v", err)
+	}
+	stats.IO.Pressure = *pressure
+	return nil
+}
+
+// ioLimit is one line of io.max
+type ioLimit struct {
+	major, minor uint32
+	// keys are rbps, wbps, riops and wiops
+	values map[string]string
+}
+
+func (l *ioLimit) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d:%d", l.major, l.minor)
+	for _, key := range []string{"rbps", "wbps", "riops", "wiops"} {
+		if value, ok := l.values[key]; ok {
+			fmt.Fprintf(&b, " %s=%s", key, value)
+		}
+	}
+	return b.String()
+}
+
+// parseIOLimits groups the device throttle flags by device
+func parseIOLimits(res *ResourceConfig) ([]*ioLimit, error) {
+	var limits []*ioLimit
+	byDevice := make(map[uint64]*ioLimit)
+
+	add := func(key string, specs []string) error {
+		for _, spec := range specs {
+			device, value, err := parseDeviceValue(spec)
+			if err != nil {
+				return err
+			}
+			major, minor, err := deviceNumber(device)
+			if err != nil {
+				return err
+			}
+			id := uint64(major)<<32 | uint64(minor)
+			limit, ok := byDevice[id]
+			if !ok {
+				limit = &ioLimit{major: major, minor: minor, values: make(map[string]string)}
+				byDevice[id] = limit
+				limits = append(limits, limit)
+			}
+			limit.values[key] = value
+		}
+		return nil
+	}
+
+	if err := add("rbps", res.DeviceReadBps); err != nil {
+		return nil, err
+	}
+	if err := add("wbps", res.DeviceWriteBps); err != nil {
+		return nil, err
+	}
+	if err := add("riops", res.DeviceReadIops); err != nil {
+		return nil, err
+	}
+	if err := add("wiops", res.DeviceWriteIops); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// parseDeviceValue splits "<device>:<value>", e.g. /dev/sda:1048576
+func parseDeviceValue(spec string) (string, string, error) {
+	idx := strings.LastIndex(spec, ":")
+	if idx <= 0 || idx == len(spec)-1 {
+		return "", "", fmt.Errorf("invalid device limit [%s], must be <device>:<value>", spec)
+	}
+	// Values are already normalized by ResourceConfig.Normalize
+	return spec[:idx], spec[idx+1:], nil
+}
+
+// deviceNumber resolves a block device path to its major and minor numbers
+func deviceNumber(device string) (uint32, uint32, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(device, &st); err != nil {
+		return 0, 0, fmt.Errorf("failed to stat device %s: %v", device, err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFBLK {
+		return 0, 0, fmt.Errorf("%s is not a block device", device)
+	}
+	return unix.Major(st.Rdev), unix.Minor(st.Rdev), nil
+}
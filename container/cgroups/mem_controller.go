@@ -14,6 +14,10 @@ func (ms *MemoryController) Name() string {
 	return "memory"
 }
 
+func (ms *MemoryController) Subsystems() []string {
+	return []string{"memory"}
+}
+
 // Set sets the resource configuration to the path
 func (ms *MemoryController) Set(path string, res *ResourceConfig) error {
 	// Ensure the path exists
@@ -61,7 +65,40 @@ func (ms *MemoryController) Set(path string, res *ResourceConfig) error {
 		log.Infof("Set memory.high: %s", res.MemoryHigh)
 	}
 
+	// Set memory.oom.group
+	if res.MemoryOomGroup {
+		if err := writeToFile(filepath.Join(path, "memory.oom.group"), "1"); err != nil {
+			return fmt.Errorf("failed to set memory.oom.group: %v", err)
+		}
+		log.Infof("Set memory.oom.group: 1")
+	}
+
 	// TODO(lqb): Set other memory constraints
 
 	return nil
 }
+
+// GetStats reads memory.current, memory.swap.current and memory.max from the path
+func (ms *MemoryController) GetStats(path string, stats *Stats) error {
+	usage, err := readUint64File(filepath.Join(path, "memory.current"))
+	if err != nil {
+		return fmt.Errorf("failed to read memory.current: %v", err)
+	}
+	stats.Memory.Usage = usage
+
+	// memory.swap.current is missing when swap accounting is disabled
+	if swap, err := readUint64File(filepath.Join(path, "memory.swap.current")); err == nil {
+		stats.Memory.SwapUsage = swap
+	}
+
+	if limit, err := readUint64File(filepath.Join(path, "memory.max")); err == nil {
+		stats.Memory.Limit = limit
+	}
+
+	pressure, err := readPressure(path, "memory")
+	if err != nil {
+		return fmt.Errorf("failed to read memory.pressure: %v", err)
+	}
+	stats.Memory.Pressure = *pressure
+	return nil
+}
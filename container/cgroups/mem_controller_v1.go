@@ -0,0 +1,108 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MemoryControllerV1 translates the resource configuration to the cgroup v1 memory hierarchy
+type MemoryControllerV1 struct{}
+
+func (ms *MemoryControllerV1) Name() string {
+	return "memory"
+}
+
+func (ms *MemoryControllerV1) Subsystems() []string {
+	return []string{"memory"}
+}
+
+// Set sets the resource configuration to the path
+func (ms *MemoryControllerV1) Set(path string, res *ResourceConfig) error {
+	if res.MemoryMin != "" || res.MemoryHigh != "" || res.MemoryOomGroup {
+		return fmt.Errorf("mem-min, mem-high and oom-group are not supported on cgroup v1")
+	}
+
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	// Set memory.limit_in_bytes
+	if res.MemoryMax != "" {
+		if err := writeToFile(filepath.Join(path, "memory.limit_in_bytes"), v1Limit(res.MemoryMax)); err != nil {
+			return fmt.Errorf("failed to set memory.limit_in_bytes: %v", err)
+		}
+		log.Infof("Set memory.limit_in_bytes: %s", res.MemoryMax)
+	}
+
+	// Set memory.memsw.limit_in_bytes, which limits memory plus swap,
+	// so it must be set after memory.limit_in_bytes
+	if res.MemorySwapMax != "" {
+		memsw := "max"
+		if res.MemorySwapMax != "max" && res.MemoryMax != "" && res.MemoryMax != "max" {
+			memory, _ := strconv.ParseUint(res.MemoryMax, 10, 64)
+			swap, _ := strconv.ParseUint(res.MemorySwapMax, 10, 64)
+			memsw = strconv.FormatUint(memory+swap, 10)
+		} else if res.MemorySwapMax != "max" {
+			return fmt.Errorf("mem-swap-max requires mem on cgroup v1")
+		}
+		if err := writeToFile(filepath.Join(path, "memory.memsw.limit_in_bytes"), v1Limit(memsw)); err != nil {
+			return fmt.Errorf("failed to set memory.memsw.limit_in_bytes: %v", err)
+		}
+		log.Infof("Set memory.memsw.limit_in_bytes: %s", memsw)
+	}
+
+	// Set memory.soft_limit_in_bytes, the closest to memory.low
+	if res.MemoryLow != "" {
+		if err := writeToFile(filepath.Join(path, "memory.soft_limit_in_bytes"), v1Limit(res.MemoryLow)); err != nil {
+			return fmt.Errorf("failed to set memory.soft_limit_in_bytes: %v", err)
+		}
+		log.Infof("Set memory.soft_limit_in_bytes: %s", res.MemoryLow)
+	}
+
+	return nil
+}
+
+// GetStats reads memory.usage_in_bytes, memory.memsw.usage_in_bytes and memory.limit_in_bytes from the path
+func (ms *MemoryControllerV1) GetStats(path string, stats *Stats) error {
+	usage, err := readUint64File(filepath.Join(path, "memory.usage_in_bytes"))
+	if err != nil {
+		return fmt.Errorf("failed to read memory.usage_in_bytes: %v", err)
+	}
+	stats.Memory.Usage = usage
+
+	// memory.memsw.* is missing when swap accounting is disabled
+	if memsw, err := readUint64File(filepath.Join(path, "memory.memsw.usage_in_bytes")); err == nil && memsw > usage {
+		stats.Memory.SwapUsage = memsw - usage
+	}
+
+	if limit, err := readUint64File(filepath.Join(path, "memory.limit_in_bytes")); err == nil {
+		stats.Memory.Limit = limit
+	}
+	return nil
+}
+
+// ReadMemoryEventsV1 reads the oom counters from memory.oom_control of the path
+func ReadMemoryEventsV1(path string) (*MemoryEvents, error) {
+	values, err := readKeyValueFile(filepath.Join(path, "memory.oom_control"))
+	if err != nil {
+		return nil, err
+	}
+	// oom_kill is only reported since Linux 4.13
+	return &MemoryEvents{
+		OOM:     values["under_oom"],
+		OOMKill: values["oom_kill"],
+	}, nil
+}
+
+// v1Limit converts "max" to -1, which means unlimited in cgroup v1
+func v1Limit(value string) string {
+	if value == "max" {
+		return "-1"
+	}
+	return value
+}
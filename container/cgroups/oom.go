@@ -0,0 +1,113 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MemoryEvents is read from memory.events, all values are counters
+type MemoryEvents struct {
+	Low          uint64
+	High         uint64
+	Max          uint64
+	OOM          uint64
+	OOMKill      uint64
+	OOMGroupKill uint64
+}
+
+// ReadMemoryEvents reads memory.events from the path
+func ReadMemoryEvents(path string) (*MemoryEvents, error) {
+	values, err := readKeyValueFile(filepath.Join(path, "memory.events"))
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryEvents{
+		Low:          values["low"],
+		High:         values["high"],
+		Max:          values["max"],
+		OOM:          values["oom"],
+		OOMKill:      values["oom_kill"],
+		OOMGroupKill: values["oom_group_kill"],
+	}, nil
+}
+
+/**
+ * @Description: OOMMonitor watches memory.events of a cgroup with inotify,
+ *	and sends the counters every time oom or oom_kill increases
+ */
+type OOMMonitor struct {
+	path    string
+	inotify *os.File
+	events  chan MemoryEvents
+}
+
+/**
+ * @Description: NewOOMMonitor starts watching memory.events of the path
+ * @param path path to the cgroup
+ * @return *OOMMonitor, error
+ */
+func NewOOMMonitor(path string) (*OOMMonitor, error) {
+	last, err := ReadMemoryEvents(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Non-blocking fd, so that the runtime poller can interrupt Read on Close
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init inotify: %v", err)
+	}
+	// The kernel notifies IN_MODIFY whenever a counter of memory.events changes
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Join(path, "memory.events"), syscall.IN_MODIFY); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to watch memory.events: %v", err)
+	}
+
+	o := &OOMMonitor{
+		path:    path,
+		inotify: os.NewFile(uintptr(fd), "inotify"),
+		events:  make(chan MemoryEvents, 16),
+	}
+	go o.run(*last)
+	return o, nil
+}
+
+// Events returns the channel of oom events, it is closed when the monitor is closed
+func (o *OOMMonitor) Events() <-chan MemoryEvents {
+	return o.events
+}
+
+// Close stops watching memory.events
+func (o *OOMMonitor) Close() error {
+	return o.inotify.Close()
+}
+
+func (o *OOMMonitor) run(last MemoryEvents) {
+	defer close(o.events)
+
+	buf := make([]byte, 4096)
+	for {
+		// We only care that the file changed, not about the event content
+		if _, err := o.inotify.Read(buf); err != nil {
+			return
+		}
+		current, err := ReadMemoryEvents(o.path)
+		if err != nil {
+			// The cgroup is gone
+			log.Debugf("failed to read memory.events of %s: %v", o.path, err)
+			return
+		}
+		if current.OOM > last.OOM || current.OOMKill > last.OOMKill {
+			select {
+			case o.events <- *current:
+			default:
+				// Nobody is listening, the counters are cumulative anyway
+			}
+		}
+		last = *current
+	}
+}
@@ -0,0 +1,59 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type PidsController struct{}
+
+func (ps *PidsController) Name() string {
+	return "pids"
+}
+
+func (ps *PidsController) Subsystems() []string {
+	return []string{"pids"}
+}
+
+// Set sets the resource configuration to the path
+func (ps *PidsController) Set(path string, res *ResourceConfig) error {
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	// Set pids.max
+	if res.PidsMax != "" {
+		if err := writeToFile(filepath.Join(path, "pids.max"), res.PidsMax); err != nil {
+			return fmt.Errorf("failed to set pids.max: %v", err)
+		}
+		log.Infof("Set pids.max: %s", res.PidsMax)
+	}
+
+	return nil
+}
+
+// GetStats reads pids.current and pids.events from the path
+func (ps *PidsController) GetStats(path string, stats *Stats) error {
+	current, err := readUint64File(filepath.Join(path, "pids.current"))
+	if err != nil {
+		return fmt.Errorf("failed to read pids.current: %v", err)
+	}
+	stats.Pids.Current = current
+
+	// pids.max is "max" when unlimited, leave Limit as 0 in that case
+	if limit, err := readUint64File(filepath.Join(path, "pids.max")); err == nil {
+		stats.Pids.Limit = limit
+	}
+
+	// pids.events contains a single "max <count>" line
+	events, err := readKeyValueFile(filepath.Join(path, "pids.events"))
+	if err != nil {
+		return fmt.Errorf("failed to read pids.events: %v", err)
+	}
+	stats.Pids.MaxEvents = events["max"]
+	return nil
+}
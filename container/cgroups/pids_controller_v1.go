@@ -0,0 +1,56 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PidsControllerV1 translates the resource configuration to the cgroup v1 pids hierarchy
+type PidsControllerV1 struct{}
+
+func (ps *PidsControllerV1) Name() string {
+	return "pids"
+}
+
+func (ps *PidsControllerV1) Subsystems() []string {
+	return []string{"pids"}
+}
+
+// Set sets the resource configuration to the path
+func (ps *PidsControllerV1) Set(path string, res *ResourceConfig) error {
+	// Ensure the path exists
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+
+	// Set pids.max, same format as cgroup v2
+	if res.PidsMax != "" {
+		if err := writeToFile(filepath.Join(path, "pids.max"), res.PidsMax); err != nil {
+			return fmt.Errorf("failed to set pids.max: %v", err)
+		}
+		log.Infof("Set pids.max: %s", res.PidsMax)
+	}
+
+	return nil
+}
+
+// GetStats reads pids.current, pids.max and pids.events from the path
+func (ps *PidsControllerV1) GetStats(path string, stats *Stats) error {
+	current, err := readUint64File(filepath.Join(path, "pids.current"))
+	if err != nil {
+		return fmt.Errorf("failed to read pids.current: %v", err)
+	}
+	stats.Pids.Current = current
+
+	if limit, err := readUint64File(filepath.Join(path, "pids.max")); err == nil {
+		stats.Pids.Limit = limit
+	}
+	// pids.events is missing on old kernels
+	if events, err := readKeyValueFile(filepath.Join(path, "pids.events")); err == nil {
+		stats.Pids.MaxEvents = events["max"]
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// Resources which expose pressure stall information, e.g. memory.pressure
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// PSIData is one line of a pressure file, averages are percentages
+type PSIData struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	// Total stall time in microseconds
+	Total uint64
+}
+
+// PSIStats is read from cpu.pressure, memory.pressure or io.pressure
+type PSIStats struct {
+	Some PSIData
+	Full PSIData
+}
+
+/**
+ * @Description: ReadPSI parses a pressure file
+ * @param filePath e.g. /sys/fs/cgroup/minidocker/memory.pressure
+ * @return *PSIStats, error
+ */
+func ReadPSI(filePath string) (*PSIStats, error) {
+	data, err := readFromFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// e.g. some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+	stats := &PSIStats{}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var psi *PSIData
+		switch fields[0] {
+		case "some":
+			psi = &stats.Some
+		case "full":
+			psi = &stats.Full
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "avg10":
+				psi.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				psi.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				psi.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				psi.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s in %s: %v", field, filePath, err)
+			}
+		}
+	}
+	return stats, nil
+}
+
+// readPressure reads <resource>.pressure of the path, it is missing when the
+// kernel is booted with psi=0, in which case empty stats are returned
+func readPressure(path string, resource string) (*PSIStats, error) {
+	filePath := filepath.Join(path, resource+".pressure")
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return &PSIStats{}, nil
+	}
+	return ReadPSI(filePath)
+}
+
+// Bounds of the trigger window enforced by the kernel
+const (
+	minPressureWindow = 500 * time.Millisecond
+	maxPressureWindow = 10 * time.Second
+)
+
+/**
+ * @Description: PressureTriggerConfig describes when a pressure event is emitted
+ * @param Resource cpu, memory or io
+ * @param Kind some or full
+ * @param Threshold stall time within Window which triggers the event
+ * @param Window length of the time window
+ */
+type PressureTriggerConfig struct {
+	Resource  string
+	Kind      string
+	Threshold time.Duration
+	Window    time.Duration
+}
+
+/**
+ * @Description: ParsePressureTrigger parses a trigger spec
+ * @param spec <resource>:<some|full>:<threshold>:<window>, e.g. memory:some:150ms:1s
+ * @return *PressureTriggerConfig, error
+ */
+func ParsePressureTrigger(spec string) (*PressureTriggerConfig, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid pressure trigger [%s], must be <resource>:<some|full>:<threshold>:<window>", spec)
+	}
+
+	cfg := &PressureTriggerConfig{Resource: parts[0], Kind: parts[1]}
+	valid := false
+	for _, resource := range pressureResources {
+		if cfg.Resource == resource {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid pressure trigger [%s], resource must be cpu, memory or io", spec)
+	}
+	if cfg.Kind != "some" && cfg.Kind != "full" {
+		return nil, fmt.Errorf("invalid pressure trigger [%s], kind must be some or full", spec)
+	}
+
+	var err error
+	if cfg.Threshold, err = time.ParseDuration(parts[2]); err != nil {
+		return nil, fmt.Errorf("invalid pressure trigger [%s], threshold: %v", spec, err)
+	}
+	if cfg.Window, err = time.ParseDuration(parts[3]); err != nil {
+		return nil, fmt.Errorf("invalid pressure trigger [%s], window: %v", spec, err)
+	}
+	if cfg.Window < minPressureWindow || cfg.Window > maxPressureWindow {
+		return nil, fmt.Errorf("invalid pressure trigger [%s], window must be between %v and %v", spec, minPressureWindow, maxPressureWindow)
+	}
+	if cfg.Threshold <= 0 || cfg.Threshold > cfg.Window {
+		return nil, fmt.Errorf("invalid pressure trigger [%s], threshold must be positive and not greater than the window", spec)
+	}
+	return cfg, nil
+}
+
+func (cfg *PressureTriggerConfig) String() string {
+	return fmt.Sprintf("%s:%s:%v:%v", cfg.Resource, cfg.Kind, cfg.Threshold, cfg.Window)
+}
+
+// PressureEvent is emitted every time a pressure trigger fires
+type PressureEvent struct {
+	Trigger PressureTriggerConfig
+	Time    time.Time
+	// Stats at the time of the event, nil if they could not be read
+	Stats *PSIStats
+}
+
+/**
+ * @Description: PressureTrigger registers a PSI trigger on a cgroup and sends an
+ *	event every time the stall time exceeds the threshold within the window
+ */
+type PressureTrigger struct {
+	cfg    PressureTriggerConfig
+	file   *os.File
+	events chan PressureEvent
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+/**
+ * @Description: NewPressureTrigger registers the trigger on <resource>.pressure of the path
+ * @param path path to the cgroup
+ * @param cfg trigger configuration
+ * @return *PressureTrigger, error
+ */
+func NewPressureTrigger(path string, cfg *PressureTriggerConfig) (*PressureTrigger, error) {
+	filePath := filepath.Join(path, cfg.Resource+".pressure")
+	// The trigger lives as long as the file stays open
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", filePath, err)
+	}
+
+	// e.g. "some 150000 1000000", both in microseconds
+	trigger := fmt.Sprintf("%s %d %d", cfg.Kind, cfg.Threshold.Microseconds(), cfg.Window.Microseconds())
+	if _, err := file.Write(append([]byte(trigger), 0)); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to register pressure trigger %s: %v", cfg, err)
+	}
+	log.Infof("Registered pressure trigger %s on %s", cfg, path)
+
+	t := &PressureTrigger{
+		cfg:    *cfg,
+		file:   file,
+		events: make(chan PressureEvent, 16),
+		done:   make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.run(filePath)
+	return t, nil
+}
+
+// Events returns the channel of pressure events, it is closed when the trigger is closed
+func (t *PressureTrigger) Events() <-chan PressureEvent {
+	return t.events
+}
+
+// Close unregisters the trigger
+func (t *PressureTrigger) Close() error {
+	close(t.done)
+	t.wg.Wait()
+	return t.file.Close()
+}
+
+// How often the poll loop checks whether the trigger was closed
+const pressurePollInterval = 500 * time.Millisecond
+
+func (t *PressureTrigger) run(filePath string) {
+	defer t.wg.Done()
+	defer close(t.events)
+
+	fds := []unix.PollFd{{Fd: int32(t.file.Fd()), Events: unix.POLLPRI}}
+	for {
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+
+		n, err := unix.Poll(fds, int(pressurePollInterval.Milliseconds()))
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			log.Errorf("failed to poll %s: %v", filePath, err)
+			return
+		}
+		if fds[0].Revents&unix.POLLERR != 0 {
+			// The cgroup is gone
+			return
+		}
+		if fds[0].Revents&unix.POLLPRI != 0 {
+			stats, err := ReadPSI(filePath)
+			if err != nil {
+				log.Debugf("failed to read %s: %v", filePath, err)
+			}
+			select {
+			case t.events <- PressureEvent{Trigger: t.cfg, Time: time.Now(), Stats: stats}:
+			default:
+				// Nobody is listening
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cgroups
+
+/**
+ * @Description: Stats is a snapshot of the resource usage of a cgroup
+ */
+type Stats struct {
+	Memory MemoryStats
+	CPU    CPUStats
+	Pids   PidsStats
+	IO     IOStats
+	// Hugetlb is keyed by page size, e.g. 2MB
+	Hugetlb map[string]HugetlbStats
+}
+
+// MemoryStats is read from memory.current, memory.swap.current and memory.max
+type MemoryStats struct {
+	Usage     uint64
+	SwapUsage uint64
+	Limit     uint64
+	// Pressure is zero when the kernel has no PSI support
+	Pressure PSIStats
+}
+
+// CPUStats is read from cpu.stat, all values are in microseconds
+type CPUStats struct {
+	UsageUsec     uint64
+	UserUsec      uint64
+	SystemUsec    uint64
+	NrPeriods     uint64
+	NrThrottled   uint64
+	ThrottledUsec uint64
+	// Quota and Period are read back from cpu.max, Quota is 0 when unlimited
+	Quota  uint64
+	Period uint64
+	// Pressure is zero when the kernel has no PSI support
+	Pressure PSIStats
+}
+
+// PidsStats is read from pids.current, pids.max and pids.events
+type PidsStats struct {
+	Current uint64
+	Limit   uint64
+	// MaxEvents is how many times fork failed because of pids.max
+	MaxEvents uint64
+}
+
+// IOStats is read from io.stat
+type IOStats struct {
+	Devices []IODeviceStats
+	// Pressure is zero when the kernel has no PSI support
+	Pressure PSIStats
+}
+
+// IODeviceStats is the io.stat line of a single device
+type IODeviceStats struct {
+	Major        uint32
+	Minor        uint32
+	ReadBytes    uint64
+	WriteBytes   uint64
+	ReadIOs      uint64
+	WriteIOs     uint64
+	DiscardBytes uint64
+	DiscardIOs   uint64
+}
+
+// HugetlbStats is read from hugetlb.<size>.current, hugetlb.<size>.max and hugetlb.<size>.events
+type HugetlbStats struct {
+	Usage uint64
+	Limit uint64
+	// MaxEvents is how many times an allocation failed because of the limit
+	MaxEvents uint64
+}
@@ -0,0 +1,105 @@
+package cgroups
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * @Description: EnableControllers enables the controllers in cgroup.subtree_control of dir,
+ *	so that they become available to the children of dir
+ * @param dir path to the parent cgroup
+ * @param names controllers to enable, e.g. cpu, memory
+ * @param evacuate move the processes of dir into a leaf child when they block enabling,
+ *	only for cgroups minidocker owns, processes of other cgroups are never moved
+ * @return []string controllers that are not available in dir, error
+ */
+func EnableControllers(dir string, names []string, evacuate bool) ([]string, error) {
+	available, err := readControllerList(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := readControllerList(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range names {
+		if _, ok := enabled[name]; ok {
+			continue
+		}
+		if _, ok := available[name]; !ok {
+			missing = append(missing, name)
+			continue
+		}
+		// Enable one controller per write, so a failure points at the culprit
+		err := writeToFile(filepath.Join(dir, "cgroup.subtree_control"), "+"+name)
+		if errors.Is(err, syscall.EBUSY) {
+			// "no internal processes" rule: a non-root cgroup can only distribute
+			// domain controllers to its children when it has no processes itself.
+			if !evacuate {
+				return missing, fmt.Errorf("failed to enable controller %s in %s: the cgroup has processes and minidocker does not own it, use a -cgroup-parent without any", name, dir)
+			}
+			if err = evacuateProcesses(dir); err == nil {
+				err = writeToFile(filepath.Join(dir, "cgroup.subtree_control"), "+"+name)
+			}
+		}
+		if err != nil {
+			return missing, fmt.Errorf("failed to enable controller %s in %s: %v", name, dir, err)
+		}
+		log.Infof("Enabled controller %s in %s", name, dir)
+	}
+	return missing, nil
+}
+
+// Helper function to read a space separated controller list,
+// e.g. cgroup.controllers or cgroup.subtree_control
+func readControllerList(filePath string) (map[string]struct{}, error) {
+	data, err := readFromFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	controllers := make(map[string]struct{})
+	for _, name := range strings.Fields(data) {
+		controllers[name] = struct{}{}
+	}
+	return controllers, nil
+}
+
+// The leaf cgroup which receives the processes living in a parent cgroup
+const evacuateLeaf = "init"
+
+// evacuateProcesses moves the processes of dir into the leaf child dir/init
+func evacuateProcesses(dir string) error {
+	data, err := readFromFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	pids := strings.Fields(data)
+	if len(pids) == 0 {
+		return fmt.Errorf("cgroup %s is busy but has no processes", dir)
+	}
+
+	leaf := filepath.Join(dir, evacuateLeaf)
+	if err := os.MkdirAll(leaf, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %v", err)
+	}
+	log.Warnf("cgroup %s has %d processes, moving them to %s", dir, len(pids), leaf)
+	for _, pid := range pids {
+		if err := writeToFile(filepath.Join(leaf, "cgroup.procs"), pid); err != nil {
+			// The process may have exited in the meantime
+			if errors.Is(err, syscall.ESRCH) {
+				continue
+			}
+			return fmt.Errorf("failed to move process %s to %s: %v", pid, leaf, err)
+		}
+	}
+	return nil
+}
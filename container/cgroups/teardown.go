@@ -0,0 +1,264 @@
+package cgroups
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Bounded exponential backoff used while waiting for a cgroup to drain or be removed
+const (
+	teardownInitialDelay = 10 * time.Millisecond
+	teardownMaxDelay     = 500 * time.Millisecond
+	teardownTimeout      = 10 * time.Second
+)
+
+// retry calls fn with exponential backoff until it succeeds or the timeout expires,
+// the last error is returned on timeout
+func retry(fn func() error) error {
+	delay := teardownInitialDelay
+	deadline := time.Now().Add(teardownTimeout)
+	for {
+		err := fn()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > teardownMaxDelay {
+			delay = teardownMaxDelay
+		}
+	}
+}
+
+/**
+ * @Description: KillCgroup kills every process in the cgroup v2 subtree and waits until it is empty.
+ *	cgroup.kill is used when the kernel has it (Linux 5.14), otherwise the subtree is frozen,
+ *	every process gets SIGKILL and the subtree is thawed so the signals are delivered.
+ * @param path path to the cgroup
+ * @return error
+ */
+func KillCgroup(path string) error {
+	killFile := filepath.Join(path, "cgroup.kill")
+	if _, err := os.Stat(killFile); err == nil {
+		if err := writeToFile(killFile, "1"); err != nil {
+			return fmt.Errorf("failed to write cgroup.kill: %v", err)
+		}
+	} else {
+		freezeFile := filepath.Join(path, "cgroup.freeze")
+		if err := writeToFile(freezeFile, "1"); err != nil {
+			return fmt.Errorf("failed to freeze cgroup: %v", err)
+		}
+		// Frozen processes can not fork, so no process escapes the kill
+		if err := waitFrozen(path); err != nil {
+			log.Warnf("cgroup %s did not freeze: %v", path, err)
+		}
+		killErr := killProcesses([]string{path})
+		if err := ThawCgroup(path); err != nil {
+			return err
+		}
+		if killErr != nil {
+			return killErr
+		}
+	}
+
+	if err := retry(func() error { return expectEvent(path, "populated", 0) }); err != nil {
+		return fmt.Errorf("cgroup %s still has processes: %v", path, err)
+	}
+	return nil
+}
+
+/**
+ * @Description: KillCgroupV1 kills every process in the cgroup v1 subtrees and waits until they are empty.
+ *	The freezer hierarchy, when mounted, stops the processes before they are killed.
+ * @param freezerPath path to the cgroup in the freezer hierarchy, empty if it is not mounted
+ * @param paths paths to the cgroup in every hierarchy
+ * @return error
+ */
+func KillCgroupV1(freezerPath string, paths []string) error {
+	if freezerPath != "" {
+		if err := writeToFile(filepath.Join(freezerPath, "freezer.state"), "FROZEN"); err != nil {
+			return fmt.Errorf("failed to freeze cgroup: %v", err)
+		}
+		if err := waitFrozenV1(freezerPath); err != nil {
+			log.Warnf("cgroup %s did not freeze: %v", freezerPath, err)
+		}
+		defer func() {
+			if err := ThawCgroupV1(freezerPath); err != nil {
+				log.Errorf("failed to thaw cgroup %s: %v", freezerPath, err)
+			}
+		}()
+	}
+	return killProcesses(paths)
+}
+
+// FreezeCgroup stops every process in the cgroup v2 subtree, it is thawed again when it does not freeze
+func FreezeCgroup(path string) error {
+	if err := writeToFile(filepath.Join(path, "cgroup.freeze"), "1"); err != nil {
+		return fmt.Errorf("failed to freeze cgroup: %v", err)
+	}
+	if err := waitFrozen(path); err != nil {
+		if thawErr := ThawCgroup(path); thawErr != nil {
+			log.Errorf("failed to thaw cgroup %s: %v", path, thawErr)
+		}
+		return fmt.Errorf("cgroup %s did not freeze: %v", path, err)
+	}
+	return nil
+}
+
+// ThawCgroup lets the processes of a frozen cgroup v2 subtree run again
+func ThawCgroup(path string) error {
+	if err := writeToFile(filepath.Join(path, "cgroup.freeze"), "0"); err != nil {
+		return fmt.Errorf("failed to thaw cgroup: %v", err)
+	}
+	return nil
+}
+
+// FreezeCgroupV1 stops every process in the cgroup v1 freezer subtree, it is thawed again when it does not freeze
+func FreezeCgroupV1(freezerPath string) error {
+	if err := writeToFile(filepath.Join(freezerPath, "freezer.state"), "FROZEN"); err != nil {
+		return fmt.Errorf("failed to freeze cgroup: %v", err)
+	}
+	if err := waitFrozenV1(freezerPath); err != nil {
+		if thawErr := ThawCgroupV1(freezerPath); thawErr != nil {
+			log.Errorf("failed to thaw cgroup %s: %v", freezerPath, thawErr)
+		}
+		return fmt.Errorf("cgroup %s did not freeze: %v", freezerPath, err)
+	}
+	return nil
+}
+
+// ThawCgroupV1 lets the processes of a frozen cgroup v1 freezer subtree run again
+func ThawCgroupV1(freezerPath string) error {
+	if err := writeToFile(filepath.Join(freezerPath, "freezer.state"), "THAWED"); err != nil {
+		return fmt.Errorf("failed to thaw cgroup: %v", err)
+	}
+	return nil
+}
+
+// waitFrozen waits until cgroup.events reports the cgroup v2 subtree frozen
+func waitFrozen(path string) error {
+	return retry(func() error { return expectEvent(path, "frozen", 1) })
+}
+
+// waitFrozenV1 waits until the freezer leaves the transitional FREEZING state
+func waitFrozenV1(freezerPath string) error {
+	return retry(func() error {
+		state, err := readFromFile(filepath.Join(freezerPath, "freezer.state"))
+		if err == nil && state != "FROZEN" {
+			err = fmt.Errorf("freezer state is %s", state)
+		}
+		return err
+	})
+}
+
+// WaitEmptyV1 waits until no process is left in the cgroup v1 subtrees,
+// v1 has no cgroup.events so cgroup.procs is polled
+func WaitEmptyV1(paths []string) error {
+	return retry(func() error {
+		pids, err := subtreePids(paths)
+		if err == nil && len(pids) > 0 {
+			err = fmt.Errorf("%d processes left", len(pids))
+		}
+		return err
+	})
+}
+
+/**
+ * @Description: RemoveCgroup removes the cgroup and its children depth-first with rmdir.
+ *	cgroupfs directories can not be removed with os.RemoveAll, because their
+ *	interface files can not be deleted. rmdir fails with EBUSY while the
+ *	cgroup still has processes, so it is retried with a bounded backoff.
+ * @param path path to the cgroup
+ * @return error
+ */
+func RemoveCgroup(path string) error {
+	entries, err := os.ReadDir(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cgroup %s: %v", path, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := RemoveCgroup(filepath.Join(path, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return retry(func() error {
+		err := syscall.Rmdir(path)
+		if err == nil || errors.Is(err, syscall.ENOENT) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove cgroup %s: %v", path, err)
+	})
+}
+
+// expectEvent checks the value of key in cgroup.events, e.g. populated 0
+func expectEvent(path string, key string, want uint64) error {
+	events, err := readKeyValueFile(filepath.Join(path, "cgroup.events"))
+	if err != nil {
+		return err
+	}
+	if events[key] != want {
+		return fmt.Errorf("%s is %d", key, events[key])
+	}
+	return nil
+}
+
+// killProcesses sends SIGKILL to every process in the subtrees
+func killProcesses(paths []string) error {
+	pids, err := subtreePids(paths)
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("failed to kill process %d: %v", pid, err)
+		}
+	}
+	return nil
+}
+
+// subtreePids collects the processes of the cgroups and all their descendants
+func subtreePids(paths []string) ([]int, error) {
+	var pids []int
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(dir string, d os.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			data, err := readFromFile(filepath.Join(dir, "cgroup.procs"))
+			if err != nil {
+				return err
+			}
+			for _, field := range strings.Fields(data) {
+				pid, err := strconv.Atoi(field)
+				if err != nil {
+					return fmt.Errorf("failed to parse pid %s in %s: %v", field, dir, err)
+				}
+				pids = append(pids, pid)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list processes of %s: %v", root, err)
+		}
+	}
+	return pids, nil
+}
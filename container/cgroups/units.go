@@ -0,0 +1,376 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Period of cpu.max in microseconds when none is given
+const defaultCPUPeriod = 100000
+
+// Bounds of cpu.max enforced by the kernel, in microseconds
+const (
+	minCPUQuota  = 1000
+	minCPUPeriod = 1000
+	maxCPUPeriod = 1000000
+)
+
+// Multipliers of the size units, e.g. 100m is 100 * 1024 * 1024 bytes
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+/**
+ * @Description: ParseBytes converts a human friendly size to bytes
+ * @param value size, e.g. 100m, 1.5g, 4096 or max
+ * @return string bytes or "max", error
+ */
+func ParseBytes(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "max" {
+		return value, nil
+	}
+
+	// split the number from the unit, e.g. 1.5g gives 1.5 and g
+	idx := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if idx == -1 {
+		idx = len(value)
+	}
+	number, unit := value[:idx], strings.ToLower(value[idx:])
+
+	multiplier, ok := byteUnits[unit]
+	if !ok || number == "" {
+		return "", fmt.Errorf("invalid size [%s], e.g. 100m, 1.5g or max", value)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	// the kernel takes an int64 at most, and converting a larger float is undefined;
+	// float64(math.MaxInt64) rounds up to 2^63, which is already out of range
+	if err != nil || n < 0 || math.Round(n*multiplier) >= math.MaxInt64 {
+		return "", fmt.Errorf("invalid size [%s], e.g. 100m, 1.5g or max", value)
+	}
+	return strconv.FormatUint(uint64(math.Round(n*multiplier)), 10), nil
+}
+
+// parseMemory converts a memory limit to bytes, percentages are of the host memory
+func parseMemory(value string) (string, error) {
+	if !strings.HasSuffix(value, "%") {
+		return ParseBytes(value)
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return "", fmt.Errorf("invalid memory percentage [%s], must be between 0%% and 100%%", value)
+	}
+	total, err := hostMemory()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(uint64(float64(total)*percent/100), 10), nil
+}
+
+// hostMemory reads MemTotal from /proc/meminfo in bytes
+func hostMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open /proc/meminfo: %v", err)
+	}
+	defer f.Close()
+
+	// e.g. MemTotal:       16318808 kB
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse MemTotal: %v", err)
+			}
+			return kb << 10, nil
+		}
+	}
+	return 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+}
+
+/**
+ * @Description: parseCPUMax converts the cpu limit to the cpu.max format "<quota> <period>"
+ * @param cpuMax max, a percentage of one cpu (e.g. 150%), a quota or "<quota> <period>" in microseconds
+ * @param cpus number of cpus, e.g. 1.5
+ * @param cpuPeriod period in microseconds, defaults to 100000
+ * @return string, error
+ */
+func parseCPUMax(cpuMax string, cpus string, cpuPeriod string) (string, error) {
+	if cpuMax != "" && cpus != "" {
+		return "", fmt.Errorf("cpu and cpus can not be set at the same time")
+	}
+	period := uint64(defaultCPUPeriod)
+	if cpuPeriod != "" {
+		var err error
+		if period, err = strconv.ParseUint(cpuPeriod, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid cpu-period [%s]: %v", cpuPeriod, err)
+		}
+	}
+
+	var quota uint64
+	switch {
+	case cpus != "":
+		n, err := strconv.ParseFloat(cpus, 64)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("invalid cpus [%s], must be a positive number, e.g. 1.5", cpus)
+		}
+		quota = uint64(math.Round(n * float64(period)))
+	case cpuMax == "" || cpuMax == "max":
+		// only the period is given
+		if err := checkCPUPeriod(period); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("max %d", period), nil
+	case strings.HasSuffix(cpuMax, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(cpuMax, "%"), 64)
+		if err != nil || percent <= 0 {
+			return "", fmt.Errorf("invalid cpu percentage [%s], must be positive, e.g. 50%%", cpuMax)
+		}
+		quota = uint64(math.Round(percent / 100 * float64(period)))
+	default:
+		fields := strings.Fields(cpuMax)
+		if len(fields) == 0 || len(fields) > 2 {
+			return "", fmt.Errorf("invalid cpu [%s], e.g. max, 50%% or 50000", cpuMax)
+		}
+		var err error
+		if quota, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+			return "", fmt.Errorf("invalid cpu quota [%s]: %v", cpuMax, err)
+		}
+		if len(fields) == 2 {
+			if cpuPeriod != "" && cpuPeriod != fields[1] {
+				return "", fmt.Errorf("cpu [%s] conflicts with cpu-period %s", cpuMax, cpuPeriod)
+			}
+			if period, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+				return "", fmt.Errorf("invalid cpu period [%s]: %v", cpuMax, err)
+			}
+		}
+	}
+
+	if err := checkCPUPeriod(period); err != nil {
+		return "", err
+	}
+	if quota < minCPUQuota {
+		return "", fmt.Errorf("cpu quota %dus is below the minimum of %dus", quota, minCPUQuota)
+	}
+	return fmt.Sprintf("%d %d", quota, period), nil
+}
+
+// checkCPUPeriod checks the period is within the bounds accepted by the kernel
+func checkCPUPeriod(period uint64) error {
+	if period < minCPUPeriod || period > maxCPUPeriod {
+		return fmt.Errorf("cpu period %dus must be between %dus and %dus", period, minCPUPeriod, maxCPUPeriod)
+	}
+	return nil
+}
+
+// parseIntRange parses a decimal integer and checks it is in [min, max]
+func parseIntRange(name string, value string, min, max int64) (string, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < min || n > max {
+		return "", fmt.Errorf("invalid %s [%s], must be between %d and %d", name, value, min, max)
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+// parseList parses a cpu or memory node list, e.g. 0-2,4, into its members
+func parseList(list string) (map[int]struct{}, error) {
+	members := make(map[int]struct{})
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid list [%s], e.g. 0-2 or 0,1", list)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("invalid list [%s], e.g. 0-2 or 0,1", list)
+			}
+		}
+		for i := start; i <= end; i++ {
+			members[i] = struct{}{}
+		}
+	}
+	return members, nil
+}
+
+/**
+ * @Description: Normalize validates the resource configuration and converts it to the
+ *	formats the kernel expects, e.g. 100m becomes 104857600. Nothing is written.
+ * @return *ResourceConfig normalized copy, error
+ */
+func (res *ResourceConfig) Normalize() (*ResourceConfig, error) {
+	out := *res
+	var err error
+
+	// Memory limits
+	memory := []struct {
+		name  string
+		value *string
+	}{
+		{"mem-min", &out.MemoryMin},
+		{"mem-low", &out.MemoryLow},
+		{"mem-high", &out.MemoryHigh},
+		{"mem", &out.MemoryMax},
+		{"mem-swap-max", &out.MemorySwapMax},
+	}
+	for _, m := range memory {
+		if *m.value == "" {
+			continue
+		}
+		if *m.value, err = parseMemory(*m.value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", m.name, err)
+		}
+	}
+	// memory.min <= memory.low <= memory.high <= memory.max
+	for i := 0; i < 4; i++ {
+		for j := i + 1; j < 4; j++ {
+			lower, upper := *memory[i].value, *memory[j].value
+			if lower == "" || upper == "" || upper == "max" {
+				continue
+			}
+			l, _ := strconv.ParseUint(lower, 10, 64)
+			u, _ := strconv.ParseUint(upper, 10, 64)
+			if lower == "max" || l > u {
+				return nil, fmt.Errorf("%s (%s) must not be greater than %s (%s)",
+					memory[i].name, res.field(i), memory[j].name, res.field(j))
+			}
+		}
+	}
+
+	// CPU limits
+	if out.CpuMax != "" || out.Cpus != "" || out.CpuPeriod != "" {
+		if out.CpuMax, err = parseCPUMax(out.CpuMax, out.Cpus, out.CpuPeriod); err != nil {
+			return nil, err
+		}
+		out.Cpus, out.CpuPeriod = "", ""
+	}
+	if out.CpuWeight != "" && out.CpuWeightNice != "" {
+		return nil, fmt.Errorf("cpu-weight and cpu-weight-nice can not be set at the same time")
+	}
+	if out.CpuWeight != "" {
+		if out.CpuWeight, err = parseIntRange("cpu-weight", out.CpuWeight, 1, 10000); err != nil {
+			return nil, err
+		}
+	}
+	if out.CpuWeightNice != "" {
+		if out.CpuWeightNice, err = parseIntRange("cpu-weight-nice", out.CpuWeightNice, -20, 19); err != nil {
+			return nil, err
+		}
+	}
+	if out.CpuSet != "" {
+		if _, err := parseList(out.CpuSet); err != nil {
+			return nil, fmt.Errorf("invalid cpuset: %v", err)
+		}
+	}
+	if out.CpuSetMems != "" {
+		if _, err := parseList(out.CpuSetMems); err != nil {
+			return nil, fmt.Errorf("invalid cpuset-mems: %v", err)
+		}
+	}
+	switch out.CpuSetPartition {
+	case "", "member":
+	case "root", "isolated":
+		if out.CpuSet == "" {
+			return nil, fmt.Errorf("cpuset-partition %s requires cpuset", out.CpuSetPartition)
+		}
+	default:
+		return nil, fmt.Errorf("invalid cpuset-partition [%s], must be member, root or isolated", out.CpuSetPartition)
+	}
+
+	// Pids limit
+	if out.PidsMax != "" && out.PidsMax != "max" {
+		if out.PidsMax, err = parseIntRange("pids-limit", out.PidsMax, 1, math.MaxInt64); err != nil {
+			return nil, err
+		}
+	}
+
+	// IO limits
+	if out.BlkioWeight != "" {
+		if out.BlkioWeight, err = parseIntRange("blkio-weight", out.BlkioWeight, 1, 10000); err != nil {
+			return nil, err
+		}
+	}
+	if out.DeviceReadBps, err = normalizeDeviceValues(out.DeviceReadBps, ParseBytes); err != nil {
+		return nil, err
+	}
+	if out.DeviceWriteBps, err = normalizeDeviceValues(out.DeviceWriteBps, ParseBytes); err != nil {
+		return nil, err
+	}
+	if out.DeviceReadIops, err = normalizeDeviceValues(out.DeviceReadIops, parseIops); err != nil {
+		return nil, err
+	}
+	if out.DeviceWriteIops, err = normalizeDeviceValues(out.DeviceWriteIops, parseIops); err != nil {
+		return nil, err
+	}
+
+	// Hugetlb limits, e.g. 2m:512m becomes 2MB:536870912
+	out.HugetlbLimits = nil
+	for _, limit := range res.HugetlbLimits {
+		size, value, ok := strings.Cut(limit, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid hugetlb limit [%s], must be <pagesize>:<limit>", limit)
+		}
+		if size, err = pageSizeName(size); err != nil {
+			return nil, err
+		}
+		if value, err = ParseBytes(value); err != nil {
+			return nil, fmt.Errorf("invalid hugetlb limit [%s]: %v", limit, err)
+		}
+		out.HugetlbLimits = append(out.HugetlbLimits, size+":"+value)
+	}
+
+	return &out, nil
+}
+
+// field returns the user given value of the i-th memory limit, for error messages
+func (res *ResourceConfig) field(i int) string {
+	return []string{res.MemoryMin, res.MemoryLow, res.MemoryHigh, res.MemoryMax}[i]
+}
+
+// parseIops checks an io per second limit, e.g. 1000 or max
+func parseIops(value string) (string, error) {
+	if value == "max" {
+		return value, nil
+	}
+	return parseIntRange("iops", value, 1, math.MaxInt64)
+}
+
+// normalizeDeviceValues converts the values of "<device>:<value>" specs
+func normalizeDeviceValues(specs []string, parse func(string) (string, error)) ([]string, error) {
+	var out []string
+	for _, spec := range specs {
+		idx := strings.LastIndex(spec, ":")
+		if idx <= 0 || idx == len(spec)-1 {
+			return nil, fmt.Errorf("invalid device limit [%s], must be <device>:<value>", spec)
+		}
+		value, err := parse(spec[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid device limit [%s]: %v", spec, err)
+		}
+		out = append(out, spec[:idx+1]+value)
+	}
+	return out, nil
+}
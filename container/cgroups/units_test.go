@@ -0,0 +1,173 @@
+package cgroups
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "4096", want: "4096"},
+		{value: "100m", want: "104857600"},
+		{value: "1.5g", want: "1610612736"},
+		{value: "1KiB", want: "1024"},
+		{value: " 2MB ", want: "2097152"},
+		{value: "max", want: "max"},
+		{value: "", wantErr: true},
+		{value: "m", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "10x", wantErr: true},
+		{value: "1.2.3", wantErr: true},
+		{value: "8589934591g", want: "9223372035781033984"},
+		{value: "8388608t", wantErr: true},
+		{value: "100000000t", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseBytes(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseBytes(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseCPUMax(t *testing.T) {
+	tests := []struct {
+		cpuMax, cpus, cpuPeriod string
+		want                    string
+		wantErr                 bool
+	}{
+		{cpuMax: "50%", want: "50000 100000"},
+		{cpuMax: "150%", cpuPeriod: "200000", want: "300000 200000"},
+		{cpus: "1.5", want: "150000 100000"},
+		{cpuMax: "max", want: "max 100000"},
+		{cpuPeriod: "50000", want: "max 50000"},
+		{cpuMax: "20000", want: "20000 100000"},
+		{cpuMax: "50000 200000", want: "50000 200000"},
+		{cpuMax: "50000 200000", cpuPeriod: "200000", want: "50000 200000"},
+		{cpuMax: "50000 200000", cpuPeriod: "100000", wantErr: true},
+		{cpuMax: "50%", cpus: "1", wantErr: true},
+		{cpuMax: "0.5%", wantErr: true},
+		{cpuMax: "-5%", wantErr: true},
+		{cpus: "0", wantErr: true},
+		{cpuMax: "500", wantErr: true},
+		{cpuMax: "1 2 3", wantErr: true},
+		{cpuPeriod: "100", wantErr: true},
+		{cpuPeriod: "2000000", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCPUMax(tt.cpuMax, tt.cpus, tt.cpuPeriod)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCPUMax(%q, %q, %q) error = %v, wantErr %v", tt.cpuMax, tt.cpus, tt.cpuPeriod, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCPUMax(%q, %q, %q) = %q, want %q", tt.cpuMax, tt.cpus, tt.cpuPeriod, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		res     ResourceConfig
+		want    ResourceConfig
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "memory units",
+			res:  ResourceConfig{MemoryLow: "64m", MemoryHigh: "1g", MemoryMax: "max"},
+			want: ResourceConfig{MemoryLow: "67108864", MemoryHigh: "1073741824", MemoryMax: "max"},
+		},
+		{
+			name:    "memory order",
+			res:     ResourceConfig{MemoryLow: "1g", MemoryMax: "512m"},
+			wantErr: true,
+		},
+		{
+			name:    "memory max below min",
+			res:     ResourceConfig{MemoryMin: "max", MemoryMax: "1g"},
+			wantErr: true,
+		},
+		{
+			name: "cpus",
+			res:  ResourceConfig{Cpus: "0.5", CpuPeriod: "200000"},
+			want: ResourceConfig{CpuMax: "100000 200000"},
+		},
+		{
+			name:    "cpu weight and nice",
+			res:     ResourceConfig{CpuWeight: "100", CpuWeightNice: "0"},
+			wantErr: true,
+		},
+		{
+			name:    "cpu weight range",
+			res:     ResourceConfig{CpuWeight: "0"},
+			wantErr: true,
+		},
+		{
+			name: "cpuset",
+			res:  ResourceConfig{CpuSet: "0-1,3", CpuSetPartition: "root"},
+			want: ResourceConfig{CpuSet: "0-1,3", CpuSetPartition: "root"},
+		},
+		{
+			name:    "partition without cpuset",
+			res:     ResourceConfig{CpuSetPartition: "isolated"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid cpuset",
+			res:     ResourceConfig{CpuSet: "2-1"},
+			wantErr: true,
+		},
+		{
+			name: "pids",
+			res:  ResourceConfig{PidsMax: "max"},
+			want: ResourceConfig{PidsMax: "max"},
+		},
+		{
+			name:    "pids range",
+			res:     ResourceConfig{PidsMax: "0"},
+			wantErr: true,
+		},
+		{
+			name: "device limits",
+			res:  ResourceConfig{DeviceReadBps: []string{"8:0:1m"}, DeviceWriteIops: []string{"/dev/sda:max"}},
+			want: ResourceConfig{DeviceReadBps: []string{"8:0:1048576"}, DeviceWriteIops: []string{"/dev/sda:max"}},
+		},
+		{
+			name:    "device limit without value",
+			res:     ResourceConfig{DeviceReadBps: []string{"8:0:"}},
+			wantErr: true,
+		},
+		{
+			name: "hugetlb",
+			res:  ResourceConfig{HugetlbLimits: []string{"2m:512m", "1GB:max"}},
+			want: ResourceConfig{HugetlbLimits: []string{"2MB:536870912", "1GB:max"}},
+		},
+		{
+			name:    "hugetlb page size",
+			res:     ResourceConfig{HugetlbLimits: []string{"1000:1g"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.res.Normalize()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Normalize() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: Normalize() = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
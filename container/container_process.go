@@ -3,7 +3,6 @@ package container
 import (
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"path"
@@ -17,10 +16,13 @@ import (
  * @Description: Create a new process with separated namespace
  * @param tty attach stdin, stdout, stderr to os.Stdin, os.Stdout, os.Stderr
  * @param command command to run
- * @param rootDir root directory of the container
+ * @param lowerDirs layers of the image top-most first, the lowerdir of the overlay
+ * @param containerDir directory of the container, holding the writable layer
+ * @param volume volume of the container, e.g. /home:/root
+ * @param cgroupRW mount the container's cgroup hierarchy read-write to delegate it
  * @return *exec.Cmd process, *os.File pipe, error
  */
-func NewProcess(command []string, rootDir string, volume string, tty bool) (*exec.Cmd, *os.File, error) {
+func NewProcess(command []string, lowerDirs []string, containerDir string, volume string, tty bool, cgroupRW bool) (*exec.Cmd, *os.File, error) {
 	log.Infof("Creating new process, command: %s, tty: %v", command, tty)
 
 	// use Pipe to communicate with the child process.
@@ -34,16 +36,20 @@ func NewProcess(command []string, rootDir string, volume string, tty bool) (*exe
 	// In Linux, /proc/self/exe is a symbolic link to the executable file of the current process.
 	// So, this command is actually executing the current process with args "init".
 	cmd := exec.Command("/proc/self/exe", "init")
+	if cgroupRW {
+		cmd.Args = append(cmd.Args, "--cgroupns-rw")
+	}
 	// Set the command's namespace to be different from the parent process.
+	// The cgroup namespace hides the host cgroup hierarchy from the container.
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS |
-			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC,
+			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWCGROUP,
 	}
 	// Set the pipe as the extra file descriptor for the command.
 	cmd.ExtraFiles = []*os.File{readPipe}
 	
-	// Use busybox as rootfs.
-	mergeDir, err := NewWorkSpace(rootDir, volume)
+	// Stack the image layers as the lower layers.
+	mergeDir, err := NewWorkSpace(lowerDirs, containerDir, volume)
 	if err != nil {
 		log.Errorf("Failed to create workspace: %v", err)
 		return nil, nil, err
@@ -60,58 +66,105 @@ func NewProcess(command []string, rootDir string, volume string, tty bool) (*exe
 
 /**
  * @Description: Initialize the container process and run the command
- * @param command command to run
- * @param args command arguments
+ * @param cgroupRW mount the container's cgroup hierarchy read-write
  * @return error
  */
-func InitContainerProcess() error {
-	err := setupMount()
+func InitContainerProcess(cgroupRW bool) error {
+	// Read the spec from the pipe first, the parent only sends it
+	// once this process is inside its cgroup.
+	spec, err := readInitSpec()
+	if err != nil {
+		log.Errorf("Failed to read init spec: %v", err)
+		return err
+	}
+	if len(spec.Args) == 0 {
+		return errors.New("no command to run in container")
+	}
+
+	if err := setupCgroupNamespace(); err != nil {
+		log.Errorf("Failed to setup cgroup namespace: %v", err)
+		return err
+	}
+
+	err = setupMount()
 	if err != nil {
 		log.Errorf("Failed to setup mount: %v", err)
 		return err
 	}
-	
-	// Read args from the pipe.
-	args := readUserCommand()
-	if len(args) == 0 {
-		return errors.New("no command to run in container") 
+
+	mountCgroup(cgroupRW)
+
+	// The command looks up its executable in the PATH of the container env
+	os.Clearenv()
+	for _, env := range spec.Env {
+		if key, value, ok := strings.Cut(env, "="); ok {
+			_ = os.Setenv(key, value)
+		}
+	}
+
+	if err := os.MkdirAll(spec.Cwd, 0755); err != nil {
+		log.Errorf("Failed to create working dir %s: %v", spec.Cwd, err)
+		return err
+	}
+	if err := syscall.Chdir(spec.Cwd); err != nil {
+		log.Errorf("Failed to change to working dir %s: %v", spec.Cwd, err)
+		return err
 	}
 
 	// Find the executable path.
-	path, err := exec.LookPath(args[0])
+	path, err := exec.LookPath(spec.Args[0])
 	if err != nil {
 		log.Errorf("Cannot find executable: %v", err)
 		return err
 	}
 	log.Infof("Find executable path: %s", path)
 
-	log.Infof("Executable: %s, Args: %v", path, args)
+	if err := setupUser(spec.User); err != nil {
+		log.Errorf("Failed to switch to user %s: %v", spec.User, err)
+		return err
+	}
+
+	log.Infof("Executable: %s, Args: %v", path, spec.Args)
 	// Execute the command.
 	// func syscall.Exec(argv0 string, argv []string, envv []string) (err error)
 	// argv0: path to the executable
 	// argv: arguments to the executable, argv[0] is the executable itself
-	if err := syscall.Exec(path, args[:], os.Environ()); err != nil {
-		log.Errorf("Failed to exec command %v: %v", args[0], err)
+	if err := syscall.Exec(path, spec.Args, os.Environ()); err != nil {
+		log.Errorf("Failed to exec command %v: %v", spec.Args[0], err)
+		return err
 	}
 
 	return nil
 }
 
-// ARGS_PIPE is the first user created FD, so it is 3
-const ARGS_PIPE_FD = 3
-// Read user command from Pipe
-func readUserCommand() []string {
-	pipe := os.NewFile(uintptr(ARGS_PIPE_FD), "pipe")
-	msg, err := io.ReadAll(pipe)
-	if err != nil {
-		log.Errorf("Failed to read args from Pipe: %v", err)
+// setupUser drops to the user the command runs as, groups first while still root
+func setupUser(spec string) error {
+	if spec == "" {
 		return nil
 	}
-	msgStr := string(msg)
-	log.Infof("Read args from Pipe: %s", msgStr)
-	return strings.Split(msgStr, " ")
+	user, err := lookupUser(spec)
+	if err != nil {
+		return err
+	}
+	if _, ok := os.LookupEnv("HOME"); !ok {
+		_ = os.Setenv("HOME", user.Home)
+	}
+	if err := syscall.Setgroups(user.Groups); err != nil {
+		return fmt.Errorf("failed to set groups: %v", err)
+	}
+	if err := syscall.Setgid(user.Gid); err != nil {
+		return fmt.Errorf("failed to set gid %d: %v", user.Gid, err)
+	}
+	if err := syscall.Setuid(user.Uid); err != nil {
+		return fmt.Errorf("failed to set uid %d: %v", user.Uid, err)
+	}
+	log.Infof("Running as uid %d, gid %d", user.Uid, user.Gid)
+	return nil
 }
 
+// INIT_PIPE_FD is the init pipe, the first extra file of the child, so it is 3
+const INIT_PIPE_FD = 3
+
 func setupMount() error {
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -231,3 +284,45 @@ func mountNecessary() error {
 	return nil
 }
 
+// setupCgroupNamespace makes sure the cgroup namespace is rooted at the container's cgroup.
+// The namespace created by clone is rooted at the cgroup the process was born in,
+// which is the parent's cgroup unless it was cloned straight into its own cgroup.
+func setupCgroupNamespace() error {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return fmt.Errorf("failed to read /proc/self/cgroup: %v", err)
+	}
+
+	// e.g. 0::/ on cgroup v2, one <id>:<controllers>:<path> line per hierarchy on v1
+	rooted := true
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) == 3 && parts[2] != "/" {
+			rooted = false
+		}
+	}
+	if rooted {
+		return nil
+	}
+
+	if err := syscall.Unshare(syscall.CLONE_NEWCGROUP); err != nil {
+		return fmt.Errorf("failed to unshare cgroup namespace: %v", err)
+	}
+	log.Infof("Cgroup namespace rooted at the container cgroup")
+	return nil
+}
+
+// mountCgroup mounts a private cgroup2 hierarchy at /sys/fs/cgroup, rooted at the
+// container's cgroup. It is read-only unless the hierarchy is delegated.
+func mountCgroup(rw bool) {
+	flags := uintptr(syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV)
+	if !rw {
+		flags |= syscall.MS_RDONLY
+	}
+	// The hierarchy is not essential to run the command, e.g. on cgroup v1 hosts
+	if err := syscall.Mount("cgroup2", "/sys/fs/cgroup", "cgroup2", flags, ""); err != nil {
+		log.Warnf("Failed to mount cgroup2 at /sys/fs/cgroup: %v", err)
+		return
+	}
+	log.Infof("Mounted cgroup2 at /sys/fs/cgroup, read-write: %v", rw)
+}
@@ -0,0 +1,197 @@
+package container
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * @Description: Info is the record of a container, stored at <root>/containers/<id>/config.json
+ * @param ID random hex id of the container
+ * @param Image image reference the container was created from
+ * @param ImageID id of the image
+ * @param Command command run in the container
+ * @param Volume volume of the container, e.g. /home:/root
+ * @param Created creation time
+ * @param State runtime state of the container
+ */
+type Info struct {
+	ID      string    `json:"id"`
+	Image   string    `json:"image"`
+	ImageID string    `json:"image_id"`
+	Command []string  `json:"command"`
+	Volume  string    `json:"volume,omitempty"`
+	Created time.Time `json:"created"`
+	State   *State    `json:"state,omitempty"`
+}
+
+// ContainersDir returns the directory holding all containers under root
+func ContainersDir(root string) string {
+	return filepath.Join(root, "containers")
+}
+
+// ContainerDir returns the directory of a container, holding its record and overlay dirs
+func ContainerDir(root string, id string) string {
+	return filepath.Join(ContainersDir(root), id)
+}
+
+/**
+ * @Description: NewInfo creates the record and directory of a new container
+ * @param root root directory of minidocker
+ * @param image image reference
+ * @param imageID id of the image
+ * @param command command to run
+ * @param volume volume of the container
+ * @return *Info, error
+ */
+func NewInfo(root string, image string, imageID string, command []string, volume string) (*Info, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate container id: %v", err)
+	}
+	info := &Info{
+		ID:      hex.EncodeToString(buf),
+		Image:   image,
+		ImageID: imageID,
+		Command: command,
+		Volume:  volume,
+		Created: time.Now(),
+	}
+	if err := os.MkdirAll(ContainerDir(root, info.ID), 0700); err != nil {
+		log.Errorf("Failed to create container dir: %v", err)
+		return nil, err
+	}
+	if err := info.Save(root); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ShortID returns the first 12 characters of the id
+func (info *Info) ShortID() string {
+	return info.ID[:12]
+}
+
+// IsRunning reports whether the container process is still alive and its pid was not reused
+func (info *Info) IsRunning() bool {
+	if info.State == nil || info.State.Status != StatusRunning {
+		return false
+	}
+	if syscall.Kill(info.State.Pid, 0) != nil {
+		return false
+	}
+	if info.State.PidStartTime == 0 {
+		// recorded before start times were kept
+		return true
+	}
+	startTime, err := ProcessStartTime(info.State.Pid)
+	return err == nil && startTime == info.State.PidStartTime
+}
+
+// Save writes the record to config.json of the container
+func (info *Info) Save(root string) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	configPath := filepath.Join(ContainerDir(root, info.ID), "config.json")
+	if err := os.WriteFile(configPath+".tmp", data, 0600); err != nil {
+		log.Errorf("Failed to write container config %s: %v", configPath, err)
+		return err
+	}
+	return os.Rename(configPath+".tmp", configPath)
+}
+
+// LoadInfo reads the record of a container
+func LoadInfo(root string, id string) (*Info, error) {
+	data, err := os.ReadFile(filepath.Join(ContainerDir(root, id), "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("failed to parse config of container %s: %v", id, err)
+	}
+	return info, nil
+}
+
+// ListInfos reads the records of all containers, unreadable records are skipped
+func ListInfos(root string) ([]*Info, error) {
+	entries, err := os.ReadDir(ContainersDir(root))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var infos []*Info
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := LoadInfo(root, entry.Name())
+		if err != nil {
+			log.Warnf("Failed to load container %s: %v", entry.Name(), err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+/**
+ * @Description: FindInfo finds a container by id or unambiguous id prefix
+ * @param root root directory of minidocker
+ * @param idOrPrefix full or short container id
+ * @return *Info, error
+ */
+func FindInfo(root string, idOrPrefix string) (*Info, error) {
+	if idOrPrefix == "" {
+		return nil, fmt.Errorf("missing container id")
+	}
+	infos, err := ListInfos(root)
+	if err != nil {
+		return nil, err
+	}
+	var found *Info
+	for _, info := range infos {
+		if info.ID == idOrPrefix {
+			return info, nil
+		}
+		if strings.HasPrefix(info.ID, idOrPrefix) {
+			if found != nil {
+				return nil, fmt.Errorf("container id prefix %s is ambiguous", idOrPrefix)
+			}
+			found = info
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no such container: %s", idOrPrefix)
+	}
+	return found, nil
+}
+
+// RemoveInfo deletes the directory of a stopped container
+func RemoveInfo(root string, id string) error {
+	// Deleting through a leftover mount would delete the image layers or volume,
+	// a lazy unmount takes the volume below merged with it
+	merged := MergedDir(ContainerDir(root, id))
+	if err := syscall.Unmount(merged, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL && err != syscall.ENOENT {
+		log.Errorf("Failed to unmount %s: %v", merged, err)
+		return err
+	}
+	if err := os.RemoveAll(ContainerDir(root, id)); err != nil {
+		log.Errorf("Failed to remove container dir %s: %v", ContainerDir(root, id), err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * @Description: InitSpec is sent by the parent over the init pipe and describes
+ *	the process the container init execs
+ * @param Args command and arguments
+ * @param Env environment of the command, e.g. PATH=/usr/bin
+ * @param Cwd working directory inside the container
+ * @param User user[:group] or uid[:gid] to run as, root when empty
+ */
+type InitSpec struct {
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+	Cwd  string   `json:"cwd"`
+	User string   `json:"user,omitempty"`
+}
+
+// SendInitSpec writes the spec to the init pipe and closes it, which lets the child go on
+func SendInitSpec(spec *InitSpec, writePipe *os.File) error {
+	defer writePipe.Close()
+	// the environment may hold secrets, it is not logged
+	log.Infof("Send init spec: args %q, cwd %s, user %s", spec.Args, spec.Cwd, spec.User)
+	if err := json.NewEncoder(writePipe).Encode(spec); err != nil {
+		return fmt.Errorf("failed to send init spec: %v", err)
+	}
+	return nil
+}
+
+// readInitSpec reads the spec sent by the parent from the init pipe
+func readInitSpec() (*InitSpec, error) {
+	pipe := os.NewFile(uintptr(INIT_PIPE_FD), "pipe")
+	defer pipe.Close()
+	msg, err := io.ReadAll(pipe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read init spec from pipe: %v", err)
+	}
+	if len(msg) == 0 {
+		return nil, fmt.Errorf("no init spec, the parent closed the pipe")
+	}
+	spec := &InitSpec{}
+	if err := json.Unmarshal(msg, spec); err != nil {
+		return nil, fmt.Errorf("failed to parse init spec: %v", err)
+	}
+	return spec, nil
+}
@@ -10,14 +10,24 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// NewWorkSpace Create an Overlay2 filesystem as container root workspace
-func NewWorkSpace(rootPath string, volume string) (string, error) {
-	lower, err := createLower(rootPath)
-	if err != nil {
-		log.Errorf("Failed to create lower dir %s, error: %v", lower, err)
-		return "", err
+/**
+ * @Description: NewWorkSpace creates an Overlay2 filesystem as container root workspace
+ * @param lowerDirs read-only layers of the image, top-most first
+ * @param rootPath directory of the container, upper, work and merged are created in it
+ * @param volume volume of the container, e.g. /home:/root
+ * @return merged dir, error
+ */
+func NewWorkSpace(lowerDirs []string, rootPath string, volume string) (string, error) {
+	if len(lowerDirs) == 0 {
+		// overlayfs needs at least one lower dir
+		return "", fmt.Errorf("image has no layers")
+	}
+	for _, lowerDir := range lowerDirs {
+		if _, err := os.Stat(lowerDir); err != nil {
+			log.Errorf("Failed to find lower dir %s, error: %v", lowerDir, err)
+			return "", err
+		}
 	}
-	log.Infof("Lower dir created: %s", lower)
 
 	upper, work, err := createUpperWork(rootPath)
 	if err != nil {
@@ -27,7 +37,7 @@ func NewWorkSpace(rootPath string, volume string) (string, error) {
 	log.Infof("Upper dir created: %s", upper)
 	log.Infof("Work dir created: %s", work)
 
-	mntDir, err := mountOverlayFS(rootPath, lower, upper, work)
+	mntDir, err := mountOverlayFS(rootPath, lowerDirs, upper, work)
 	if err != nil {
 		log.Errorf("Failed to mount overlay fs, error: %v", err)
 		return "", err
@@ -51,14 +61,6 @@ func NewWorkSpace(rootPath string, volume string) (string, error) {
 	return mntDir, nil
 }
 
-func fileExists(path string) (bool, error) {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false, nil
-	}
-	return err == nil, err
-}
-
 func volumeExtract(volume string) (sourcePath, destinationPath string, err error) {
 	parts := strings.Split(volume, ":")
 	if len(parts) != 2 {
@@ -73,30 +75,6 @@ func volumeExtract(volume string) (sourcePath, destinationPath string, err error
 	return sourcePath, destinationPath, nil
 }
 
-// Create lower layer
-func createLower(rootURL string) (string, error) {
-	busyboxURL := path.Join(rootURL, "busybox")
-	busyboxTarURL := path.Join(rootURL, "busybox.tar")
-
-	exist, err := fileExists(busyboxURL)
-	if err != nil {
-		log.Infof("Failed to judge whether dir %s exists. %v", busyboxURL, err)
-		return "", err
-	}
-
-	if !exist {
-		if err := os.Mkdir(busyboxURL, 0777); err != nil {
-			log.Errorf("Failed to make dir %s, error: %v", busyboxURL, err)
-			return "", err
-		}
-		if _, err := exec.Command("tar", "-xvf", busyboxTarURL, "-C", busyboxURL).CombinedOutput(); err != nil {
-			log.Errorf("Failed to untar %s, error: %v", busyboxURL, err)
-			return "", err
-		}
-	}
-	return busyboxURL, nil
-}
-
 func createUpperWork(rootURL string) (string, string, error) {
 	upperURL := path.Join(rootURL, "upper")
 	if err := os.Mkdir(upperURL, 0777); err != nil {
@@ -112,7 +90,7 @@ func createUpperWork(rootURL string) (string, string, error) {
 }
 
 // mount -t overlay overlay -o lowerdir=lower1:lower2:lower3,upperdir=upper,workdir=work merged
-func mountOverlayFS(rootURL, lowerURL, upperURL, workURL string) (string, error) {
+func mountOverlayFS(rootURL string, lowerURLs []string, upperURL, workURL string) (string, error) {
 	mntURL := path.Join(rootURL, "merged")
 	if err := os.Mkdir(mntURL, 0777); err != nil {
 		log.Errorf("Failed to make merge dir %s, error: %v", mntURL, err)
@@ -120,8 +98,8 @@ func mountOverlayFS(rootURL, lowerURL, upperURL, workURL string) (string, error)
 	}
 	log.Infof("Merged dir created: %s", mntURL)
 
-	// e.g. lowerdir=/root/busybox,upperdir=/root/upper,workdir=/root/work
-	dirs := "lowerdir=" + lowerURL + ",upperdir=" + upperURL + ",workdir=" + workURL
+	// e.g. lowerdir=/root/l3:/root/l2:/root/l1,upperdir=/root/upper,workdir=/root/work
+	dirs := "lowerdir=" + strings.Join(lowerURLs, ":") + ",upperdir=" + upperURL + ",workdir=" + workURL
 	log.Infof("Overlay dirs: %s", dirs)
 
 	// dirs := "dirs=" + rootURL + "writeLayer:" + rootURL + "busybox"
@@ -159,8 +137,69 @@ func mountVolume(mntPath, hostPath, containerPath string) error {
 }
 
 
+// UpperDir returns the writable layer of a container, holding its changes to the image
+func UpperDir(rootURL string) string {
+	return path.Join(rootURL, "upper")
+}
+
+// MergedDir returns the mountpoint of the container root filesystem
+func MergedDir(rootURL string) string {
+	return path.Join(rootURL, "merged")
+}
+
+/**
+ * @Description: MountStoppedWorkSpace mounts the filesystem of a stopped container at target,
+ *	read-only stacks the upper dir on the image layers so that nothing can be written
+ * @param lowerDirs layers of the image, top-most first
+ * @param rootURL directory of the container
+ * @param target mountpoint, must exist
+ * @param readOnly mount without the writable layer
+ * @return error
+ */
+func MountStoppedWorkSpace(lowerDirs []string, rootURL string, target string, readOnly bool) error {
+	if len(lowerDirs) == 0 {
+		return fmt.Errorf("image has no layers")
+	}
+	var dirs string
+	if readOnly {
+		// whiteouts of the upper dir still hide files when it is a lower layer
+		dirs = "ro,lowerdir=" + strings.Join(append([]string{UpperDir(rootURL)}, lowerDirs...), ":")
+	} else {
+		dirs = "lowerdir=" + strings.Join(lowerDirs, ":") + ",upperdir=" + UpperDir(rootURL) + ",workdir=" + path.Join(rootURL, "work")
+	}
+	log.Infof("Overlay dirs: %s", dirs)
+
+	cmd := exec.Command("mount", "-t", "overlay", "overlay", "-o", dirs, target)
+	// stdout may carry an archive, e.g. export
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Errorf("Failed to mount overlay fs at %s, error: %v", target, err)
+		return err
+	}
+	return nil
+}
+
+// UnmountStoppedWorkSpace unmounts a filesystem mounted by MountStoppedWorkSpace
+func UnmountStoppedWorkSpace(target string) {
+	cmd := exec.Command("umount", target)
+	// stdout may carry an archive, e.g. export
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Errorf("Failed to umount overlay fs at %s, error: %v", target, err)
+	}
+}
+
 // DeleteWorkSpace Delete the AUFS filesystem while container exit
 func DeleteWorkSpace(rootURL string, volume string) {
+	UnmountWorkSpace(rootURL, volume)
+	deleteDirs(rootURL)
+	log.Infof("Overlay dirs deleted")
+}
+
+// UnmountWorkSpace unmounts the filesystem of a stopped container but keeps its upper dir
+func UnmountWorkSpace(rootURL string, volume string) {
 	// Must umount volume first!!
 	if volume != "" {
 		_, containerPath, err := volumeExtract(volume)
@@ -173,8 +212,6 @@ func DeleteWorkSpace(rootURL string, volume string) {
 
 	umountOverlayFS(rootURL)
 	log.Infof("Overlay fs unmounted")
-	deleteDirs(rootURL)
-	log.Infof("Overlay dirs deleted")
 }
 
 func umountVolume(mntPath, containerPath string) {
@@ -0,0 +1,62 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Container status
+const (
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+)
+
+/**
+ * @Description: State is the runtime state of a container
+ * @param Pid pid of the container init process on the host
+ * @param PidStartTime start time of the process in clock ticks since boot, tells a reused pid apart
+ * @param Status running or stopped
+ * @param Cgroup cgroup of the container relative to the cgroup root, empty when it runs without one
+ * @param ExitCode exit code of the container init process
+ * @param OOMKilled whether the kernel OOM killer killed a process of the container
+ * @param OOMKillCount how many processes the OOM killer killed
+ */
+type State struct {
+	Pid          int
+	PidStartTime uint64
+	Status       string
+	Cgroup       string
+	ExitCode     int
+	OOMKilled    bool
+	OOMKillCount uint64
+	StartedAt    time.Time
+	FinishedAt   time.Time
+}
+
+/**
+ * @Description: ProcessStartTime reads the start time of the process from /proc/<pid>/stat,
+ *	it stays the same for the life of the process, so a pid reused by another process differs
+ * @param pid process id
+ * @return start time in clock ticks since boot, error
+ */
+func ProcessStartTime(pid int) (uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// the command name may contain spaces and parentheses, the fields follow the last ')'
+	stat := string(data)
+	idx := strings.LastIndex(stat, ")")
+	if idx == -1 {
+		return 0, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	// starttime is field 22, the fields after the name start with field 3
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"syscall"
 
 	cgroups "minidocker/container/cgroups"
 
@@ -15,9 +16,22 @@ import (
 	"github.com/pkg/errors"
 )
 
+// DefaultCgroupParent is the cgroup, relative to the cgroup root, which holds all containers
+const DefaultCgroupParent = "minidocker"
+
+// Versions of the cgroup hierarchy
+const (
+	CgroupV1 = 1
+	CgroupV2 = 2
+)
+
 type CgroupsManager struct {
 	mutex 			sync.Mutex
+	version     int
+	// cgroupsRoot is the cgroup2 mountpoint, only used by v2
 	cgroupsRoot string
+	// mounts maps each controller name to its hierarchy mountpoint, only used by v1
+	mounts      map[string]string
 	cgroups     map[string]struct{}
 	controllers []cgroups.Controller
 }
@@ -26,38 +40,189 @@ type CgroupsManager struct {
 var (
 	once            sync.Once
 	globalCgroupMgr *CgroupsManager
+	globalInitErr   error
 )
 
 func GetCgroupsManager() (*CgroupsManager, error) {
-	var initErr error
 	// init globalCgroupMgr
 	once.Do(func() {
-		cgroupsRoot, err := findCgroups2Mountpoint()
-		if err != nil {
-			log.Errorf("failed to find cgroup2 mountpoint err: %v\n", err)
-			initErr = errors.New("failed to find cgroup2 mountpoint")
+		if cgroupsRoot, err := findCgroups2Mountpoint(); err == nil && hasControllers(cgroupsRoot) && !hasV1Hierarchies() {
+			globalCgroupMgr = &CgroupsManager{
+				version:     CgroupV2,
+				cgroupsRoot: cgroupsRoot,
+				cgroups: make(map[string]struct{}),
+				controllers: []cgroups.Controller{
+					&cgroups.MemoryController{},
+					&cgroups.CPUController{},
+					&cgroups.PidsController{},
+					&cgroups.IOController{},
+					&cgroups.HugetlbController{},
+				},
+			}
 			return
 		}
 
-		globalCgroupMgr = &CgroupsManager{
-			cgroupsRoot: cgroupsRoot,
+		// No unified hierarchy with the controllers, fall back to the v1 hierarchies
+		log.Infof("cgroup controllers bound to v1, falling back to cgroup v1")
+		mgr := &CgroupsManager{
+			version: CgroupV1,
+			mounts:  make(map[string]string),
 			cgroups: make(map[string]struct{}),
-			controllers: []cgroups.Controller{
-				&cgroups.MemoryController{},
-				&cgroups.CPUController{},
-			},
 		}
+		for _, controller := range []cgroups.Controller{
+			&cgroups.MemoryControllerV1{},
+			&cgroups.CPUControllerV1{},
+			&cgroups.CpuacctControllerV1{},
+			&cgroups.CpusetControllerV1{},
+			&cgroups.PidsControllerV1{},
+			&cgroups.BlkioControllerV1{},
+			&cgroups.HugetlbControllerV1{},
+			&cgroups.FreezerControllerV1{},
+		} {
+			mountpoint, err := findSubsystemMountpoint(controller.Name())
+			if err != nil || mountpoint == "" {
+				log.Warnf("cgroup v1 %s hierarchy not found, its limits can not be set", controller.Name())
+				continue
+			}
+			log.Infof("cgroup v1 %s mountpoint: %s", controller.Name(), mountpoint)
+			mgr.mounts[controller.Name()] = mountpoint
+			mgr.controllers = append(mgr.controllers, controller)
+		}
+		if len(mgr.controllers) == 0 {
+			globalInitErr = errors.New("neither cgroup2 nor cgroup v1 hierarchies found")
+			return
+		}
+		globalCgroupMgr = mgr
 	})
 
-	if initErr != nil {
-		log.Printf("failed to init cgroup manager err: %v\n", initErr)
-		return nil, initErr
+	if globalInitErr != nil {
+		log.Printf("failed to init cgroup manager err: %v\n", globalInitErr)
+		return nil, globalInitErr
 	}
 
-	log.Info("cgroup manager initialized")
+	log.Infof("cgroup manager initialized, cgroup v%d", globalCgroupMgr.version)
 	return globalCgroupMgr, nil
 }
 
+// Version returns the version of the cgroup hierarchy in use, CgroupV1 or CgroupV2
+func (m *CgroupsManager) Version() int {
+	return m.version
+}
+
+// hasV1Hierarchies reports whether the main controllers are bound to cgroup v1 hierarchies.
+// A hybrid host also mounts a cgroup2 hierarchy, which may even have a few controllers,
+// e.g. hugetlb, but writing the limits of a controller bound to v1 there fails.
+func hasV1Hierarchies() bool {
+	bound, err := v1Controllers()
+	if err != nil {
+		log.Warnf("failed to read /proc/self/cgroup, looking for v1 mounts: %v", err)
+	}
+	for _, subsystem := range []string{"memory", "cpu", "pids"} {
+		if _, ok := bound[subsystem]; ok {
+			return true
+		}
+		if mountpoint, err := findSubsystemMountpoint(subsystem); err == nil && mountpoint != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// v1Controllers returns the controllers bound to a v1 hierarchy, read from /proc/self/cgroup,
+// e.g. "4:memory:/" is a v1 hierarchy while "0::/" is the unified one
+func v1Controllers() (map[string]struct{}, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	controllers := make(map[string]struct{})
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[0] == "0" {
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller != "" {
+				controllers[controller] = struct{}{}
+			}
+		}
+	}
+	return controllers, nil
+}
+
+// v1Hierarchies are the cgroup v1 hierarchies which enforce limits
+var v1Hierarchies = []string{"memory", "cpu", "cpuset", "pids", "blkio", "hugetlb"}
+
+// v1LimitFlags returns the flags of the limits set in a normalized config, keyed by
+// the cgroup v1 hierarchy which enforces them
+func v1LimitFlags(res *cgroups.ResourceConfig) map[string][]string {
+	flags := make(map[string][]string)
+	add := func(hierarchy string, flag string, set bool) {
+		if set {
+			flags[hierarchy] = append(flags[hierarchy], flag)
+		}
+	}
+	add("memory", "mem", res.MemoryMax != "")
+	add("memory", "mem-min", res.MemoryMin != "")
+	add("memory", "mem-low", res.MemoryLow != "")
+	add("memory", "mem-high", res.MemoryHigh != "")
+	add("memory", "mem-swap-max", res.MemorySwapMax != "")
+	add("memory", "oom-group", res.MemoryOomGroup)
+	// cpus and cpu-period are folded into cpu by Normalize
+	add("cpu", "cpu", res.CpuMax != "")
+	add("cpu", "cpu-weight", res.CpuWeight != "")
+	add("cpu", "cpu-weight-nice", res.CpuWeightNice != "")
+	add("cpuset", "cpuset", res.CpuSet != "")
+	add("cpuset", "cpuset-mems", res.CpuSetMems != "")
+	add("cpuset", "cpuset-partition", res.CpuSetPartition != "")
+	add("pids", "pids-limit", res.PidsMax != "")
+	add("blkio", "blkio-weight", res.BlkioWeight != "")
+	add("blkio", "device-read-bps", len(res.DeviceReadBps) > 0)
+	add("blkio", "device-write-bps", len(res.DeviceWriteBps) > 0)
+	add("blkio", "device-read-iops", len(res.DeviceReadIops) > 0)
+	add("blkio", "device-write-iops", len(res.DeviceWriteIops) > 0)
+	add("hugetlb", "hugetlb", len(res.HugetlbLimits) > 0)
+	return flags
+}
+
+// hasControllers reports whether the cgroup2 root has any controller, a host
+// may mount an empty cgroup2 hierarchy without any v1 one
+func hasControllers(cgroupsRoot string) bool {
+	data, err := os.ReadFile(path.Join(cgroupsRoot, "cgroup.controllers"))
+	return err == nil && len(strings.TrimSpace(string(data))) > 0
+}
+
+// cgroupDir returns the directory of the cgroup under mountpoint, a name can not climb out of it
+func cgroupDir(mountpoint string, name string) string {
+	return path.Join(mountpoint, path.Clean("/"+name))
+}
+
+// controllerPath returns the directory of the cgroup in the hierarchy of the controller
+func (m *CgroupsManager) controllerPath(controller cgroups.Controller, name string) string {
+	if m.version == CgroupV1 {
+		return cgroupDir(m.mounts[controller.Name()], name)
+	}
+	return cgroupDir(m.cgroupsRoot, name)
+}
+
+// paths returns the distinct directories of the cgroup, one per hierarchy
+func (m *CgroupsManager) paths(name string) []string {
+	if m.version == CgroupV2 {
+		return []string{cgroupDir(m.cgroupsRoot, name)}
+	}
+	var dirs []string
+	seen := make(map[string]struct{})
+	for _, controller := range m.controllers {
+		// co-mounted controllers, e.g. cpu,cpuacct, share one directory
+		dir := m.controllerPath(controller, name)
+		if _, ok := seen[dir]; !ok {
+			seen[dir] = struct{}{}
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
 func (m *CgroupsManager) CreateCgroup(name string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -67,16 +232,86 @@ func (m *CgroupsManager) CreateCgroup(name string) error {
 		return nil
 	}
 
-	fullPath := path.Join(m.cgroupsRoot, name)
-	if err := os.MkdirAll(fullPath, 0755); err != nil {
-		log.Errorf("failed to create cgroup err: %v\n", err)
-		return err
+	// cgroup v1 has no subtree_control, every controller is always enabled
+	if m.version == CgroupV2 {
+		if err := m.enableControllers(name); err != nil {
+			log.Errorf("failed to enable controllers for cgroup %s err: %v\n", name, err)
+			return err
+		}
+	}
+
+	for _, fullPath := range m.paths(name) {
+		if err := os.MkdirAll(fullPath, 0755); err != nil {
+			log.Errorf("failed to create cgroup err: %v\n", err)
+			return err
+		}
+		log.Info("cgroup created:", fullPath)
 	}
-	log.Info("cgroup created:", fullPath)
 	m.cgroups[name] = struct{}{}
 	return nil
 }
 
+// enableControllers enables the controllers needed by m.controllers in
+// cgroup.subtree_control of every ancestor of the cgroup, from the root down.
+func (m *CgroupsManager) enableControllers(name string) error {
+	var required []string
+	seen := make(map[string]struct{})
+	for _, controller := range m.controllers {
+		for _, subsystem := range controller.Subsystems() {
+			if _, ok := seen[subsystem]; !ok {
+				seen[subsystem] = struct{}{}
+				required = append(required, subsystem)
+			}
+		}
+	}
+
+	// e.g. name a/b/c gives root, root/a and root/a/b
+	dirs := []string{m.cgroupsRoot}
+	for _, part := range strings.Split(path.Dir(path.Clean("/"+name)), "/") {
+		if part != "" {
+			dirs = append(dirs, path.Join(dirs[len(dirs)-1], part))
+		}
+	}
+
+	// processes are only ever moved out of the tree minidocker creates, never out of
+	// a user given parent, e.g. system.slice/foo.service
+	owned := cgroupDir(m.cgroupsRoot, DefaultCgroupParent)
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		evacuate := dir == owned || strings.HasPrefix(dir, owned+"/")
+		missing, err := cgroups.EnableControllers(dir, required, evacuate)
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			// Limits of these controllers can not be set, Set will report it if they are requested
+			log.Warnf("cgroup controllers unavailable in %s: %s", dir, strings.Join(missing, ", "))
+			required = subtract(required, missing)
+		}
+	}
+	return nil
+}
+
+// subtract returns the elements of list which are not in remove
+func subtract(list, remove []string) []string {
+	var result []string
+	for _, item := range list {
+		found := false
+		for _, r := range remove {
+			if item == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 func (m *CgroupsManager) Apply(cg_name string, pid int) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -86,9 +321,34 @@ func (m *CgroupsManager) Apply(cg_name string, pid int) error {
 		return errors.New("cgroup not found")
 	}
 
-	full_path := path.Join(m.cgroupsRoot, cg_name)
-	procsFile := path.Join(full_path, "/cgroup.procs")
-	return os.WriteFile(procsFile, []byte(fmt.Sprintf("%d", pid)), 0644)
+	for _, full_path := range m.paths(cg_name) {
+		procsFile := path.Join(full_path, "/cgroup.procs")
+		if err := os.WriteFile(procsFile, []byte(fmt.Sprintf("%d", pid)), 0644); err != nil {
+			log.Errorf("failed to apply cgroup %s err: %v\n", full_path, err)
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * @Description: OpenCgroupFD opens the cgroup directory, so that a process can be
+ *	cloned straight into it with CLONE_INTO_CGROUP. Only supported on cgroup v2.
+ * @param cg_name cgroup name
+ * @return *os.File, error
+ */
+func (m *CgroupsManager) OpenCgroupFD(cg_name string) (*os.File, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.cgroups[cg_name]; !ok {
+		log.Errorf("failed to open cgroup, cgroup %s not found\n", cg_name)
+		return nil, errors.New("cgroup not found")
+	}
+	if m.version == CgroupV1 {
+		return nil, errors.New("cloning into a cgroup is not supported on cgroup v1")
+	}
+	return os.OpenFile(cgroupDir(m.cgroupsRoot, cg_name), os.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
 }
 
 func (m *CgroupsManager) Destroy(cg_name string) error {
@@ -98,16 +358,91 @@ func (m *CgroupsManager) Destroy(cg_name string) error {
 		log.Infof("cgroup %s not found\n", cg_name)
 		return nil
 	}
-	full_path := path.Join(m.cgroupsRoot, cg_name)
-	if err := os.RemoveAll(full_path); err != nil {
-		log.Errorf("failed to destroy cgroup %s err: %v\n", cg_name, err)
+	// Kill the stragglers first, a cgroup with processes can not be removed
+	if err := m.killProcesses(cg_name); err != nil {
+		log.Errorf("failed to kill processes of cgroup %s err: %v\n", cg_name, err)
 		return err
 	}
+
+	for _, full_path := range m.paths(cg_name) {
+		if err := cgroups.RemoveCgroup(full_path); err != nil {
+			log.Errorf("failed to destroy cgroup %s err: %v\n", cg_name, err)
+			return err
+		}
+		log.Info("cgroup destroyed:", full_path)
+	}
 	delete(m.cgroups, cg_name)
-	log.Info("cgroup destroyed:", full_path)
 	return nil
 }
 
+/**
+ * @Description: Kill kills every process in the cgroup and waits until it is empty. The cgroup
+ *	may belong to a container run by another process, e.g. rm -f, so it only has to exist.
+ * @param cg_name cgroup name
+ * @return error
+ */
+func (m *CgroupsManager) Kill(cg_name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, err := os.Stat(m.paths(cg_name)[0]); err != nil {
+		log.Errorf("failed to kill cgroup %s err: %v\n", cg_name, err)
+		return fmt.Errorf("cgroup %s not found: %v", cg_name, err)
+	}
+	return m.killProcesses(cg_name)
+}
+
+/**
+ * @Description: Freeze stops every process in the cgroup until Thaw, e.g. while the
+ *	filesystem of a running container is accessed from the host
+ * @param cg_name cgroup name, the cgroup only has to exist
+ * @return error
+ */
+func (m *CgroupsManager) Freeze(cg_name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.version == CgroupV2 {
+		return cgroups.FreezeCgroup(cgroupDir(m.cgroupsRoot, cg_name))
+	}
+	mountpoint, ok := m.mounts["freezer"]
+	if !ok {
+		return errors.New("cgroup v1 freezer hierarchy not found")
+	}
+	return cgroups.FreezeCgroupV1(cgroupDir(mountpoint, cg_name))
+}
+
+// Thaw lets the processes of a cgroup stopped by Freeze run again
+func (m *CgroupsManager) Thaw(cg_name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.version == CgroupV2 {
+		return cgroups.ThawCgroup(cgroupDir(m.cgroupsRoot, cg_name))
+	}
+	mountpoint, ok := m.mounts["freezer"]
+	if !ok {
+		return errors.New("cgroup v1 freezer hierarchy not found")
+	}
+	return cgroups.ThawCgroupV1(cgroupDir(mountpoint, cg_name))
+}
+
+// killProcesses kills the processes of the cgroup, freezing it first where possible
+func (m *CgroupsManager) killProcesses(cg_name string) error {
+	paths := m.paths(cg_name)
+	if m.version == CgroupV2 {
+		return cgroups.KillCgroup(paths[0])
+	}
+	freezerPath := ""
+	if mountpoint, ok := m.mounts["freezer"]; ok {
+		freezerPath = cgroupDir(mountpoint, cg_name)
+	}
+	if err := cgroups.KillCgroupV1(freezerPath, paths); err != nil {
+		return err
+	}
+	return cgroups.WaitEmptyV1(paths)
+}
+
 func (m *CgroupsManager) Set(cg_name string, res *cgroups.ResourceConfig) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -117,9 +452,28 @@ func (m *CgroupsManager) Set(cg_name string, res *cgroups.ResourceConfig) error
 		return errors.New("cgroup not found")
 	}
 
-	full_path := path.Join(m.cgroupsRoot, cg_name)
+	// Reject invalid limits before any file is written
+	res, err := res.Normalize()
+	if err != nil {
+		log.Errorf("invalid resource config for cgroup %s err: %v\n", cg_name, err)
+		return err
+	}
+
+	// A v1 hierarchy which is not mounted has no controller, its limits would be dropped
+	if m.version == CgroupV1 {
+		limits := v1LimitFlags(res)
+		for _, hierarchy := range v1Hierarchies {
+			flags := limits[hierarchy]
+			if _, ok := m.mounts[hierarchy]; !ok && len(flags) > 0 {
+				err := fmt.Errorf("%s can not be set, the cgroup v1 %s hierarchy is not mounted", strings.Join(flags, ", "), hierarchy)
+				log.Errorf("failed to set cgroup %s err: %v\n", cg_name, err)
+				return err
+			}
+		}
+	}
+
 	for _, controller := range m.controllers {
-		if err := controller.Set(full_path, res); err != nil {
+		if err := controller.Set(m.controllerPath(controller, cg_name), res); err != nil {
 			log.Errorf("failed to set cgroup %s err: %v\n", cg_name, err)
 			return err
 		}
@@ -127,12 +481,84 @@ func (m *CgroupsManager) Set(cg_name string, res *cgroups.ResourceConfig) error
 	return nil
 }
 
+func (m *CgroupsManager) GetStats(cg_name string) (*cgroups.Stats, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.cgroups[cg_name]; !ok {
+		log.Errorf("failed to get stats, cgroup %s not found\n", cg_name)
+		return nil, errors.New("cgroup not found")
+	}
+
+	// A controller which is not enabled for the cgroup must not hide the stats of the others
+	stats := &cgroups.Stats{}
+	var lastErr error
+	read := 0
+	for _, controller := range m.controllers {
+		if err := controller.GetStats(m.controllerPath(controller, cg_name), stats); err != nil {
+			log.Warnf("failed to get %s stats of cgroup %s err: %v\n", controller.Name(), cg_name, err)
+			lastErr = err
+			continue
+		}
+		read++
+	}
+	if read == 0 && lastErr != nil {
+		return nil, fmt.Errorf("failed to get stats of cgroup %s: %v", cg_name, lastErr)
+	}
+	return stats, nil
+}
+
+func (m *CgroupsManager) WatchOOM(cg_name string) (*cgroups.OOMMonitor, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.cgroups[cg_name]; !ok {
+		log.Errorf("failed to watch oom, cgroup %s not found\n", cg_name)
+		return nil, errors.New("cgroup not found")
+	}
+	if m.version == CgroupV1 {
+		return nil, errors.New("oom monitor is not supported on cgroup v1")
+	}
+	return cgroups.NewOOMMonitor(cgroupDir(m.cgroupsRoot, cg_name))
+}
+
+func (m *CgroupsManager) WatchPressure(cg_name string, cfg *cgroups.PressureTriggerConfig) (*cgroups.PressureTrigger, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.cgroups[cg_name]; !ok {
+		log.Errorf("failed to watch pressure, cgroup %s not found\n", cg_name)
+		return nil, errors.New("cgroup not found")
+	}
+	if m.version == CgroupV1 {
+		return nil, errors.New("pressure stall information is not supported on cgroup v1")
+	}
+	return cgroups.NewPressureTrigger(cgroupDir(m.cgroupsRoot, cg_name), cfg)
+}
+
+func (m *CgroupsManager) GetMemoryEvents(cg_name string) (*cgroups.MemoryEvents, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.cgroups[cg_name]; !ok {
+		log.Errorf("failed to get memory events, cgroup %s not found\n", cg_name)
+		return nil, errors.New("cgroup not found")
+	}
+	if m.version == CgroupV1 {
+		if _, ok := m.mounts["memory"]; !ok {
+			return nil, errors.New("cgroup v1 memory hierarchy not found")
+		}
+		return cgroups.ReadMemoryEventsV1(cgroupDir(m.mounts["memory"], cg_name))
+	}
+	return cgroups.ReadMemoryEvents(cgroupDir(m.cgroupsRoot, cg_name))
+}
+
 // Index of the mountpoint in the fields of /proc/self/mountinfo
 const mountPointIndex = 4
 
 /**
- * @Description: findSubsystemMountpoint finds the mountpoint of the subsystem
- * @Note: This function reads is deprecated because we use cgroup2
+ * @Description: findSubsystemMountpoint finds the mountpoint of the cgroup v1 subsystem
+ * @Note: Only used when the host has no cgroup2 hierarchy with controllers
  * @param subsystem subsystem name
  * @return string, error
  */
@@ -151,6 +577,10 @@ func findSubsystemMountpoint(subsystem string) (string, error) {
 	for scanner.Scan() {
 		txt := scanner.Text()
 		fields := strings.Split(txt, " ")
+		// skip mounts other than cgroup v1, the filesystem type is the third field from the end
+		if len(fields) < 3 || fields[len(fields)-3] != "cgroup" {
+			continue
+		}
 		subsystems := strings.Split(fields[len(fields)-1], ",")
 		for _, opt := range subsystems {
 			if opt == subsystem {
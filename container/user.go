@@ -0,0 +1,126 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Description: ExecUser is the identity the container command runs as
+ * @param Uid user id
+ * @param Gid primary group id
+ * @param Groups supplementary group ids
+ * @param Home home directory, used as HOME when the env has none
+ */
+type ExecUser struct {
+	Uid    int
+	Gid    int
+	Groups []int
+	Home   string
+}
+
+/**
+ * @Description: lookupUser resolves user[:group] against /etc/passwd and /etc/group of
+ *	the current root, numeric ids need no entry, like docker's --user
+ * @param spec e.g. nobody, 1000, 1000:1000 or www-data:www-data
+ * @return *ExecUser, error
+ */
+func lookupUser(spec string) (*ExecUser, error) {
+	userPart, groupPart, hasGroup := strings.Cut(spec, ":")
+	user := &ExecUser{Home: "/"}
+
+	passwd, err := readColonFile("/etc/passwd")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	found := false
+	for _, entry := range passwd {
+		// name:password:uid:gid:gecos:home:shell
+		if len(entry) < 7 || (entry[0] != userPart && entry[2] != userPart) {
+			continue
+		}
+		if user.Uid, err = strconv.Atoi(entry[2]); err != nil {
+			return nil, fmt.Errorf("invalid uid of user %s in /etc/passwd", entry[0])
+		}
+		if user.Gid, err = strconv.Atoi(entry[3]); err != nil {
+			return nil, fmt.Errorf("invalid gid of user %s in /etc/passwd", entry[0])
+		}
+		user.Home = entry[5]
+		userPart = entry[0]
+		found = true
+		break
+	}
+	if !found {
+		uid, err := strconv.Atoi(userPart)
+		if err != nil || uid < 0 {
+			return nil, fmt.Errorf("unable to find user %s: no matching entries in passwd file", userPart)
+		}
+		// an unknown uid runs with gid 0 like in docker
+		user.Uid = uid
+	}
+
+	groups, err := readColonFile("/etc/group")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if hasGroup {
+		found = false
+		for _, entry := range groups {
+			// name:password:gid:members
+			if len(entry) < 4 || (entry[0] != groupPart && entry[2] != groupPart) {
+				continue
+			}
+			if user.Gid, err = strconv.Atoi(entry[2]); err != nil {
+				return nil, fmt.Errorf("invalid gid of group %s in /etc/group", entry[0])
+			}
+			found = true
+			break
+		}
+		if !found {
+			gid, err := strconv.Atoi(groupPart)
+			if err != nil || gid < 0 {
+				return nil, fmt.Errorf("unable to find group %s: no matching entries in group file", groupPart)
+			}
+			user.Gid = gid
+		}
+		return user, nil
+	}
+
+	// supplementary groups only come with a named user and no explicit group
+	for _, entry := range groups {
+		if len(entry) < 4 {
+			continue
+		}
+		for _, member := range strings.Split(entry[3], ",") {
+			if member == userPart {
+				if gid, err := strconv.Atoi(entry[2]); err == nil && gid != user.Gid {
+					user.Groups = append(user.Groups, gid)
+				}
+			}
+		}
+	}
+	return user, nil
+}
+
+// readColonFile reads a passwd style file into its colon separated fields
+func readColonFile(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	return entries, scanner.Err()
+}
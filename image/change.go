@@ -0,0 +1,123 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/**
+ * @Description: ApplyChanges applies Dockerfile instructions to a copy of the config,
+ *	CMD, ENTRYPOINT, ENV, EXPOSE, USER and WORKDIR are supported like in docker commit
+ * @param config config to start from, may be nil
+ * @param changes instructions, e.g. CMD ["/bin/sh"] or ENV FOO=bar
+ * @return *Config, error
+ */
+func ApplyChanges(config *Config, changes []string) (*Config, error) {
+	result := config.Copy()
+	for _, change := range changes {
+		instruction, args, _ := strings.Cut(strings.TrimSpace(change), " ")
+		args = strings.TrimSpace(args)
+		if args == "" {
+			return nil, fmt.Errorf("invalid change [%s], missing arguments", change)
+		}
+
+		switch strings.ToUpper(instruction) {
+		case "CMD":
+			result.Cmd = parseCommand(args)
+		case "ENTRYPOINT":
+			result.Entrypoint = parseCommand(args)
+		case "ENV":
+			env, err := parseEnv(args)
+			if err != nil {
+				return nil, fmt.Errorf("invalid change [%s]: %v", change, err)
+			}
+			result.Env = mergeEnvList(result.Env, env)
+		case "EXPOSE":
+			for _, port := range strings.Fields(args) {
+				if !strings.Contains(port, "/") {
+					port += "/tcp"
+				}
+				if result.ExposedPorts == nil {
+					result.ExposedPorts = make(map[string]struct{})
+				}
+				result.ExposedPorts[port] = struct{}{}
+			}
+		case "USER":
+			result.User = args
+		case "WORKDIR":
+			if !strings.HasPrefix(args, "/") {
+				// relative to the previous working dir, like in a Dockerfile
+				args = strings.TrimSuffix(result.WorkingDir, "/") + "/" + args
+			}
+			result.WorkingDir = args
+		default:
+			return nil, fmt.Errorf("invalid change [%s], %s is not supported", change, instruction)
+		}
+	}
+	return result, nil
+}
+
+// Copy returns a deep copy of the config, a nil config copies to an empty one
+func (c *Config) Copy() *Config {
+	result := &Config{}
+	if c == nil {
+		return result
+	}
+	*result = *c
+	result.Env = append([]string(nil), c.Env...)
+	result.Entrypoint = append([]string(nil), c.Entrypoint...)
+	result.Cmd = append([]string(nil), c.Cmd...)
+	if c.ExposedPorts != nil {
+		result.ExposedPorts = make(map[string]struct{}, len(c.ExposedPorts))
+		for port := range c.ExposedPorts {
+			result.ExposedPorts[port] = struct{}{}
+		}
+	}
+	return result
+}
+
+// parseCommand parses the exec form ["a", "b"], anything else is run by /bin/sh -c
+func parseCommand(args string) []string {
+	var command []string
+	if strings.HasPrefix(args, "[") && json.Unmarshal([]byte(args), &command) == nil {
+		return command
+	}
+	return []string{"/bin/sh", "-c", args}
+}
+
+// parseEnv parses "KEY=VALUE KEY2=VALUE2" or the legacy "KEY VALUE"
+func parseEnv(args string) ([]string, error) {
+	key, value, _ := strings.Cut(args, " ")
+	if !strings.Contains(key, "=") {
+		return []string{key + "=" + strings.TrimSpace(value)}, nil
+	}
+	var env []string
+	for _, entry := range strings.Fields(args) {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid env %s, must be KEY=VALUE", entry)
+		}
+		env = append(env, key+"="+strings.Trim(value, `"`))
+	}
+	return env, nil
+}
+
+// mergeEnvList overrides env by key with overrides, new keys are appended
+func mergeEnvList(env []string, overrides []string) []string {
+	index := make(map[string]int)
+	for i, entry := range env {
+		key, _, _ := strings.Cut(entry, "=")
+		index[key] = i
+	}
+	for _, entry := range overrides {
+		key, _, _ := strings.Cut(entry, "=")
+		if i, ok := index[key]; ok {
+			env[i] = entry
+		} else {
+			index[key] = len(env)
+			env = append(env, entry)
+		}
+	}
+	return env
+}
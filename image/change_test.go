@@ -0,0 +1,97 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyChanges(t *testing.T) {
+	base := &Config{
+		Env:        []string{"PATH=/bin", "FOO=1"},
+		Cmd:        []string{"/bin/sh"},
+		WorkingDir: "/app",
+	}
+	tests := []struct {
+		name    string
+		config  *Config
+		changes []string
+		want    *Config
+		wantErr bool
+	}{
+		{
+			name:   "no changes",
+			config: base,
+			want:   base,
+		},
+		{
+			name:    "nil config",
+			changes: []string{"USER nobody"},
+			want:    &Config{User: "nobody"},
+		},
+		{
+			name:    "exec and shell form",
+			config:  base,
+			changes: []string{`CMD ["/bin/ls", "-l"]`, "entrypoint echo hi"},
+			want: &Config{
+				Env:        []string{"PATH=/bin", "FOO=1"},
+				Cmd:        []string{"/bin/ls", "-l"},
+				Entrypoint: []string{"/bin/sh", "-c", "echo hi"},
+				WorkingDir: "/app",
+			},
+		},
+		{
+			name:    "env overrides by key",
+			config:  base,
+			changes: []string{`ENV FOO=2 BAR="x"`, "ENV LEGACY some value"},
+			want: &Config{
+				Env:        []string{"PATH=/bin", "FOO=2", "BAR=x", "LEGACY=some value"},
+				Cmd:        []string{"/bin/sh"},
+				WorkingDir: "/app",
+			},
+		},
+		{
+			name:    "expose and relative workdir",
+			config:  base,
+			changes: []string{"EXPOSE 80 53/udp", "WORKDIR src"},
+			want: &Config{
+				Env:          []string{"PATH=/bin", "FOO=1"},
+				Cmd:          []string{"/bin/sh"},
+				WorkingDir:   "/app/src",
+				ExposedPorts: map[string]struct{}{"80/tcp": {}, "53/udp": {}},
+			},
+		},
+		{
+			name:    "missing arguments",
+			config:  base,
+			changes: []string{"CMD"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported instruction",
+			config:  base,
+			changes: []string{"RUN make"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid env",
+			config:  base,
+			changes: []string{"ENV A=1 =2"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := ApplyChanges(tt.config, tt.changes)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ApplyChanges() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ApplyChanges() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// the config of the image must not change
+	if !reflect.DeepEqual(base.Env, []string{"PATH=/bin", "FOO=1"}) || base.ExposedPorts != nil {
+		t.Errorf("ApplyChanges() modified its input: %+v", base)
+	}
+}
@@ -0,0 +1,20 @@
+package image
+
+/**
+ * @Description: Config holds the default run settings of an image,
+ *	named like the config section of an OCI image config
+ * @param User user or uid[:gid] the command runs as
+ * @param ExposedPorts ports the image listens on, e.g. 80/tcp
+ * @param Env environment variables, e.g. PATH=/usr/bin
+ * @param Entrypoint command the arguments are passed to
+ * @param Cmd default arguments, or the command when there is no entrypoint
+ * @param WorkingDir working directory of the command
+ */
+type Config struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+}
@@ -0,0 +1,249 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	archive "minidocker/archive"
+)
+
+// digestPrefix prefixes the sha256 digests of layers, e.g. sha256:e3b0c442...
+const digestPrefix = "sha256:"
+
+/**
+ * @Description: Layers are stored once per diff id, the digest of the uncompressed layer tar
+ *	layers/sha256/<hex>/diff/   unpacked layer with overlayfs whiteouts
+ */
+func (s *Store) layersDir() string {
+	return filepath.Join(s.root, "layers", "sha256")
+}
+
+/**
+ * @Description: lockLayers locks the layers against garbage collection. A layer is
+ *	registered before the image referring to it is created, so imports hold a shared
+ *	lock from the first register to the create, and the collection an exclusive one.
+ * @param exclusive take the exclusive lock of the collection
+ * @return unlock function, error
+ */
+func (s *Store) lockLayers(exclusive bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.layersDir()), 0700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(filepath.Dir(s.layersDir()), ".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(lock.Fd()), how); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("failed to lock layers: %v", err)
+	}
+	return func() {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		lock.Close()
+	}, nil
+}
+
+// LayerDir returns the unpacked directory of a layer
+func (s *Store) LayerDir(diffID string) string {
+	return filepath.Join(s.layersDir(), strings.TrimPrefix(diffID, digestPrefix), "diff")
+}
+
+// hasLayer reports whether the layer is already unpacked
+func (s *Store) hasLayer(diffID string) bool {
+	_, err := os.Stat(s.LayerDir(diffID))
+	return err == nil
+}
+
+// LowerDirs returns the layer dirs of the image top-most first, as overlayfs lowerdir wants them
+func (s *Store) LowerDirs(img *Image) []string {
+	dirs := make([]string, 0, len(img.Layers))
+	for i := len(img.Layers) - 1; i >= 0; i-- {
+		dirs = append(dirs, s.LayerDir(img.Layers[i]))
+	}
+	return dirs
+}
+
+/**
+ * @Description: RegisterLayer unpacks a layer tarball into the store, a layer which is
+ *	already present is not unpacked again
+ * @param r uncompressed layer tar stream
+ * @param expected diff id the layer must have, empty when it is not known
+ * @return diff id of the layer, error
+ */
+func (s *Store) RegisterLayer(r io.Reader, expected string) (string, error) {
+	if err := os.MkdirAll(s.layersDir(), 0700); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(s.layersDir(), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	digester := sha256.New()
+	tee := io.TeeReader(r, digester)
+	opts := &archive.ExtractOptions{OverlayWhiteouts: true}
+	if err := archive.Extract(tee, filepath.Join(tmp, "diff"), opts); err != nil {
+		return "", err
+	}
+	// The digest covers the padding after the end of archive marker as well
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return "", err
+	}
+	diffID := digestPrefix + hex.EncodeToString(digester.Sum(nil))
+	if expected != "" && diffID != expected {
+		return "", fmt.Errorf("layer diff id mismatch: expected %s, got %s", expected, diffID)
+	}
+
+	layerDir := filepath.Dir(s.LayerDir(diffID))
+	if _, err := os.Stat(layerDir); err == nil {
+		log.Infof("Layer %s already exists", shortID(strings.TrimPrefix(diffID, digestPrefix)))
+		return diffID, nil
+	}
+	if err := os.Rename(tmp, layerDir); err != nil {
+		// lost a race against an import of the same layer
+		if errors.Is(err, os.ErrExist) || errors.Is(err, syscall.ENOTEMPTY) {
+			return diffID, nil
+		}
+		return "", err
+	}
+	log.Infof("Layer %s registered", shortID(strings.TrimPrefix(diffID, digestPrefix)))
+	return diffID, nil
+}
+
+// removeUnusedLayers deletes the layers no image refers to any more
+func (s *Store) removeUnusedLayers() error {
+	unlock, err := s.lockLayers(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	used := make(map[string]bool)
+	entries, err := os.ReadDir(s.imagesDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		img, err := s.load(entry.Name())
+		if err != nil {
+			// keep every layer when an image can not be read
+			return fmt.Errorf("failed to load image %s: %v", entry.Name(), err)
+		}
+		for _, diffID := range img.Layers {
+			used[strings.TrimPrefix(diffID, digestPrefix)] = true
+		}
+	}
+
+	layers, err := os.ReadDir(s.layersDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		if used[layer.Name()] || strings.HasPrefix(layer.Name(), ".tmp-") {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.layersDir(), layer.Name())); err != nil {
+			return err
+		}
+		log.Infof("Deleted layer %s", shortID(layer.Name()))
+	}
+	return nil
+}
+
+/**
+ * @Description: Commit creates an image from a parent image and a new layer on top of it
+ * @param parent image the layer was made on
+ * @param ref name[:tag] of the new image
+ * @param layer uncompressed layer tar stream
+ * @param config config of the new image
+ * @return *Image, error
+ */
+func (s *Store) Commit(parent *Image, ref string, layer io.Reader, config *Config) (*Image, error) {
+	if _, _, err := ParseReference(ref); err != nil {
+		return nil, err
+	}
+	unlock, err := s.lockLayers(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	diffID, err := s.RegisterLayer(layer, "")
+	if err != nil {
+		return nil, err
+	}
+	layers := append(append([]string{}, parent.Layers...), diffID)
+	return s.Create(ref, layers, config)
+}
+
+/**
+ * @Description: migrateRootfs turns the unpacked images/<id>/rootfs of images stored
+ *	before layers existed into a single layer each
+ * @return error
+ */
+func (s *Store) migrateRootfs() error {
+	entries, err := os.ReadDir(s.imagesDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		rootfs := filepath.Join(s.imageDir(entry.Name()), "rootfs")
+		if _, err := os.Stat(rootfs); err != nil || !entry.IsDir() {
+			continue
+		}
+		img, err := s.load(entry.Name())
+		if err != nil || len(img.Layers) > 0 {
+			continue
+		}
+		if err := s.migrateImage(img, rootfs); err != nil {
+			return fmt.Errorf("failed to migrate image %s: %v", shortID(img.ID), err)
+		}
+		log.Infof("Image %s migrated to layer %s", shortID(img.ID), shortID(strings.TrimPrefix(img.Layers[0], digestPrefix)))
+	}
+	return nil
+}
+
+// migrateImage registers the rootfs of the image as its only layer
+func (s *Store) migrateImage(img *Image, rootfs string) error {
+	unlock, err := s.lockLayers(false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(archive.Tar(pw, rootfs, &archive.TarOptions{}))
+	}()
+	diffID, err := s.RegisterLayer(pr, "")
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return err
+	}
+	img.Layers = []string{diffID}
+	if img.Size, err = dirSize(s.LayerDir(diffID)); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(s.imageDir(img.ID), "image.json"), img); err != nil {
+		return err
+	}
+	return os.RemoveAll(rootfs)
+}
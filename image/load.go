@@ -0,0 +1,441 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	archive "minidocker/archive"
+)
+
+// Media types of the indexes which point at one manifest per platform
+const (
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// Annotations naming the images of an OCI layout
+const (
+	annotationRefName        = "org.opencontainers.image.ref.name"
+	annotationContainerdName = "io.containerd.image.name"
+)
+
+// maxIndexDepth bounds the nesting of indexes in an OCI layout
+const maxIndexDepth = 4
+
+var hexDigestRegexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// descriptor points at a blob of an OCI layout
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *platform         `json:"platform,omitempty"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// ociIndex is index.json of an OCI layout, or a nested image index
+type ociIndex struct {
+	Manifests []descriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Config descriptor   `json:"config"`
+	Layers []descriptor `json:"layers"`
+}
+
+// imageConfig is the image config blob shared by OCI and docker images
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Config       Config `json:"config"`
+	RootFS       struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// dockerManifest is an entry of manifest.json written by docker save
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+/**
+ * @Description: loadEntry is an image found in an archive, digests are
+ *	empty when the format does not record them
+ */
+type loadEntry struct {
+	// names is empty for an image loaded untagged
+	names        []string
+	configPath   string
+	configDigest string
+	layerPaths   []string
+	layerDigests []string
+}
+
+/**
+ * @Description: Load registers the images of an OCI image layout or docker save archive,
+ *	every blob is checked against its digest and every layer against its diff id
+ * @param r archive stream, optionally compressed
+ * @param name repository name for OCI images annotated with a tag only, empty loads them untagged
+ * @return loaded images, error
+ */
+func (s *Store) Load(r io.Reader, name string) ([]*Image, error) {
+	if name != "" {
+		if _, _, err := ParseReference(name); err != nil {
+			return nil, err
+		}
+	}
+	stream, err := DecompressStream(r)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	tmpRoot := filepath.Join(s.root, "tmp")
+	if err := os.MkdirAll(tmpRoot, 0700); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(tmpRoot, "load-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := archive.Extract(stream, dir, &archive.ExtractOptions{NoLchown: true}); err != nil {
+		return nil, fmt.Errorf("failed to extract archive: %v", err)
+	}
+
+	// docker 25 and later write both files, manifest.json has the tags
+	var entries []*loadEntry
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err == nil {
+		entries, err = readDockerArchive(dir)
+		if err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		entries, err = readOCILayout(dir, name)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("archive has neither manifest.json nor index.json")
+	}
+
+	unlock, err := s.lockLayers(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	var images []*Image
+	for _, entry := range entries {
+		img, err := s.loadEntry(entry)
+		if err != nil {
+			return images, fmt.Errorf("failed to load %s: %v", entry.label(), err)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// loadEntry registers the layers of an entry and creates its image
+func (s *Store) loadEntry(entry *loadEntry) (*Image, error) {
+	if entry.configDigest != "" {
+		if err := verifyDigest(entry.configPath, entry.configDigest); err != nil {
+			return nil, err
+		}
+	}
+	config := &imageConfig{}
+	if err := readJSON(entry.configPath, config); err != nil {
+		return nil, fmt.Errorf("failed to read image config: %v", err)
+	}
+	if config.OS != "" && config.OS != runtime.GOOS {
+		log.Warnf("Image %s is built for %s/%s", entry.label(), config.OS, config.Architecture)
+	}
+	if len(config.RootFS.DiffIDs) != len(entry.layerPaths) {
+		return nil, fmt.Errorf("image config has %d diff ids for %d layers", len(config.RootFS.DiffIDs), len(entry.layerPaths))
+	}
+
+	for i, layerPath := range entry.layerPaths {
+		diffID := config.RootFS.DiffIDs[i]
+		if _, err := digestHex(diffID); err != nil {
+			return nil, err
+		}
+		if entry.layerDigests[i] != "" {
+			if err := verifyDigest(layerPath, entry.layerDigests[i]); err != nil {
+				return nil, err
+			}
+		}
+		if s.hasLayer(diffID) {
+			// the blob must still be the layer the config claims it is
+			if err := verifyDiffID(layerPath, diffID); err != nil {
+				return nil, err
+			}
+			log.Infof("Layer %s already exists", shortID(strings.TrimPrefix(diffID, digestPrefix)))
+			continue
+		}
+		if err := s.registerLayerFile(layerPath, diffID); err != nil {
+			return nil, err
+		}
+	}
+
+	ref := ""
+	if len(entry.names) > 0 {
+		ref = entry.names[0]
+	}
+	img, err := s.Create(ref, config.RootFS.DiffIDs, &config.Config)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(entry.names); i++ {
+		if err := s.Tag(img, entry.names[i]); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// label names the entry in messages, by its first name or its config
+func (entry *loadEntry) label() string {
+	if len(entry.names) > 0 {
+		return entry.names[0]
+	}
+	return filepath.Base(entry.configPath)
+}
+
+// registerLayerFile registers a layer blob and checks that it unpacks to diffID
+func (s *Store) registerLayerFile(layerPath string, diffID string) error {
+	file, err := os.Open(layerPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stream, err := DecompressStream(file)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	_, err = s.RegisterLayer(stream, diffID)
+	return err
+}
+
+// readDockerArchive reads manifest.json written by docker save
+func readDockerArchive(dir string) ([]*loadEntry, error) {
+	var manifests []dockerManifest
+	if err := readJSON(filepath.Join(dir, "manifest.json"), &manifests); err != nil {
+		return nil, fmt.Errorf("failed to read manifest.json: %v", err)
+	}
+
+	var entries []*loadEntry
+	for _, manifest := range manifests {
+		// an image saved by id has no tag and is loaded untagged
+		configPath, err := archive.SecureJoin(dir, manifest.Config)
+		if err != nil {
+			return nil, err
+		}
+		entry := &loadEntry{
+			names:        manifest.RepoTags,
+			configPath:   configPath,
+			configDigest: digestFromPath(manifest.Config),
+		}
+		for _, layer := range manifest.Layers {
+			layerPath, err := archive.SecureJoin(dir, layer)
+			if err != nil {
+				return nil, err
+			}
+			entry.layerPaths = append(entry.layerPaths, layerPath)
+			entry.layerDigests = append(entry.layerDigests, digestFromPath(layer))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readOCILayout reads index.json of an OCI image layout, name is the repository
+// of images whose ref.name annotation is a tag only
+func readOCILayout(dir string, name string) ([]*loadEntry, error) {
+	var index ociIndex
+	if err := readJSON(filepath.Join(dir, "index.json"), &index); err != nil {
+		return nil, fmt.Errorf("failed to read index.json: %v", err)
+	}
+
+	var entries []*loadEntry
+	for _, desc := range index.Manifests {
+		var names []string
+		if ref := ociReference(desc.Annotations, name); ref != "" {
+			names = []string{ref}
+		} else {
+			log.Warnf("Image %s has no name, loading it untagged", desc.Digest)
+		}
+
+		manifest, err := readOCIManifest(dir, desc, 0)
+		if err != nil {
+			return nil, err
+		}
+		configPath, err := blobPath(dir, manifest.Config.Digest)
+		if err != nil {
+			return nil, err
+		}
+		entry := &loadEntry{
+			names:        names,
+			configPath:   configPath,
+			configDigest: manifest.Config.Digest,
+		}
+		for _, layer := range manifest.Layers {
+			layerPath, err := blobPath(dir, layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+			entry.layerPaths = append(entry.layerPaths, layerPath)
+			entry.layerDigests = append(entry.layerDigests, layer.Digest)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+/**
+ * @Description: ociReference names an image of an OCI layout. io.containerd.image.name holds
+ *	a full reference, org.opencontainers.image.ref.name either a full reference or only a tag,
+ *	e.g. latest, which is given to the repository of name
+ * @param annotations annotations of the manifest descriptor
+ * @param name name[:tag] given by the user, empty if none
+ * @return name:tag, empty when the image has no name
+ */
+func ociReference(annotations map[string]string, name string) string {
+	if ref := annotations[annotationContainerdName]; ref != "" {
+		return ref
+	}
+	ref := annotations[annotationRefName]
+	switch {
+	case ref == "":
+		return name
+	case strings.ContainsAny(ref, ":/"):
+		return ref
+	case name == "":
+		// a tag alone, the repository is unknown
+		return ""
+	default:
+		repository, _, _ := ParseReference(name)
+		return repository + ":" + ref
+	}
+}
+
+// readOCIManifest reads the manifest desc points at, an index is resolved to the manifest of this platform
+func readOCIManifest(dir string, desc descriptor, depth int) (*ociManifest, error) {
+	path, err := blobPath(dir, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyDigest(path, desc.Digest); err != nil {
+		return nil, err
+	}
+
+	if desc.MediaType != mediaTypeOCIIndex && desc.MediaType != mediaTypeDockerManifestList {
+		manifest := &ociManifest{}
+		if err := readJSON(path, manifest); err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %v", desc.Digest, err)
+		}
+		return manifest, nil
+	}
+
+	if depth >= maxIndexDepth {
+		return nil, fmt.Errorf("image index %s is nested too deep", desc.Digest)
+	}
+	var index ociIndex
+	if err := readJSON(path, &index); err != nil {
+		return nil, fmt.Errorf("failed to read index %s: %v", desc.Digest, err)
+	}
+	for _, m := range index.Manifests {
+		if m.Platform == nil || (m.Platform.OS == runtime.GOOS && m.Platform.Architecture == runtime.GOARCH) {
+			return readOCIManifest(dir, m, depth+1)
+		}
+	}
+	return nil, fmt.Errorf("image index %s has no manifest for %s/%s", desc.Digest, runtime.GOOS, runtime.GOARCH)
+}
+
+// blobPath returns the path of a blob in an OCI layout
+func blobPath(dir string, digest string) (string, error) {
+	hexDigest, err := digestHex(digest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "blobs", "sha256", hexDigest), nil
+}
+
+// digestHex checks a sha256:<hex> digest and returns its hex part
+func digestHex(digest string) (string, error) {
+	hexDigest := strings.TrimPrefix(digest, digestPrefix)
+	if !strings.HasPrefix(digest, digestPrefix) || !hexDigestRegexp.MatchString(hexDigest) {
+		return "", fmt.Errorf("unsupported digest %q", digest)
+	}
+	return hexDigest, nil
+}
+
+// digestFromPath returns the digest a docker save path is named after,
+// e.g. <hex>.json or blobs/sha256/<hex>, and "" for legacy <id>/layer.tar
+func digestFromPath(path string) string {
+	base := filepath.Base(path)
+	hexDigest := strings.TrimSuffix(base, ".json")
+	if !hexDigestRegexp.MatchString(hexDigest) {
+		return ""
+	}
+	if hexDigest != base || filepath.Base(filepath.Dir(path)) == "sha256" {
+		return digestPrefix + hexDigest
+	}
+	return ""
+}
+
+// verifyDigest checks that the sha256 of the file matches digest
+func verifyDigest(path string, digest string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return checkDigest(file, digest)
+}
+
+// verifyDiffID checks that the sha256 of the uncompressed layer blob matches diffID
+func verifyDiffID(path string, diffID string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stream, err := DecompressStream(file)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	return checkDigest(stream, diffID)
+}
+
+func checkDigest(r io.Reader, digest string) error {
+	expected, err := digestHex(digest)
+	if err != nil {
+		return err
+	}
+	digester := sha256.New()
+	if _, err := io.Copy(digester, r); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(digester.Sum(nil)); got != expected {
+		return fmt.Errorf("digest mismatch: expected %s, got %s%s", digest, digestPrefix, got)
+	}
+	return nil
+}
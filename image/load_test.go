@@ -0,0 +1,199 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// digestOf returns the sha256 digest of data
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return digestPrefix + hex.EncodeToString(sum[:])
+}
+
+// tarFiles writes regular files into an in-memory tar, parent directories are implied
+func tarFiles(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// loadFixture is an image with a single layer
+type loadFixture struct {
+	config []byte
+	layer  []byte
+}
+
+// newLoadFixture creates the blobs of the image, tamper diffids gives the config an extra diff id
+func newLoadFixture(t *testing.T, tamper string) *loadFixture {
+	layer := tarFiles(t, map[string][]byte{"hello": []byte("hello\n")})
+	config := &imageConfig{OS: "linux", Config: Config{Cmd: []string{"/hello"}}}
+	config.RootFS.Type = "layers"
+	config.RootFS.DiffIDs = []string{digestOf(layer)}
+	if tamper == "diffids" {
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, digestOf(layer))
+	}
+	return &loadFixture{config: mustJSON(t, config), layer: layer}
+}
+
+// blobs returns the config and layer blobs with their digests, tamper config or layer
+// changes that blob after its digest is taken
+func (f *loadFixture) blobs(tamper string) (map[string][]byte, string, string) {
+	configDigest, layerDigest := digestOf(f.config), digestOf(f.layer)
+	config, layer := f.config, f.layer
+	// still valid JSON and a valid tar, only the digest tells them apart
+	if tamper == "config" {
+		config = append(append([]byte{}, config...), ' ')
+	}
+	if tamper == "layer" {
+		layer = append(append([]byte{}, layer...), make([]byte, 512)...)
+	}
+	blobs := map[string][]byte{
+		"blobs/sha256/" + strings.TrimPrefix(configDigest, digestPrefix): config,
+		"blobs/sha256/" + strings.TrimPrefix(layerDigest, digestPrefix):  layer,
+	}
+	return blobs, configDigest, layerDigest
+}
+
+// ociArchive builds an OCI image layout with one manifest annotated with annotations
+func ociArchive(t *testing.T, tamper string, annotations map[string]string) *bytes.Reader {
+	f := newLoadFixture(t, tamper)
+	files, configDigest, layerDigest := f.blobs(tamper)
+	manifest := mustJSON(t, &ociManifest{
+		Config: descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: configDigest, Size: int64(len(f.config))},
+		Layers: []descriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar", Digest: layerDigest, Size: int64(len(f.layer))}},
+	})
+	files["blobs/sha256/"+strings.TrimPrefix(digestOf(manifest), digestPrefix)] = manifest
+	files["index.json"] = mustJSON(t, &ociIndex{Manifests: []descriptor{{
+		MediaType:   "application/vnd.oci.image.manifest.v1+json",
+		Digest:      digestOf(manifest),
+		Size:        int64(len(manifest)),
+		Annotations: annotations,
+	}}})
+	files["oci-layout"] = []byte(`{"imageLayoutVersion":"1.0.0"}`)
+	return bytes.NewReader(tarFiles(t, files))
+}
+
+// dockerArchive builds a docker save archive with blobs named after their digests
+func dockerArchive(t *testing.T, tamper string, repoTags []string) *bytes.Reader {
+	f := newLoadFixture(t, tamper)
+	files, configDigest, layerDigest := f.blobs(tamper)
+	files["manifest.json"] = mustJSON(t, []dockerManifest{{
+		Config:   "blobs/sha256/" + strings.TrimPrefix(configDigest, digestPrefix),
+		RepoTags: repoTags,
+		Layers:   []string{"blobs/sha256/" + strings.TrimPrefix(layerDigest, digestPrefix)},
+	}})
+	return bytes.NewReader(tarFiles(t, files))
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		docker      bool
+		tamper      string
+		annotations map[string]string
+		repoTags    []string
+		ref         string
+		want        string
+		wantErr     string
+	}{
+		{name: "oci full reference", annotations: map[string]string{annotationRefName: "busybox:1.36"}, want: "busybox:1.36"},
+		{name: "oci tag only with name", annotations: map[string]string{annotationRefName: "v1"}, ref: "myrepo:ignored", want: "myrepo:v1"},
+		{name: "oci tag only without name", annotations: map[string]string{annotationRefName: "v1"}, want: ""},
+		{name: "oci config digest mismatch", tamper: "config", wantErr: "digest mismatch"},
+		{name: "oci layer digest mismatch", tamper: "layer", wantErr: "digest mismatch"},
+		{name: "oci diff ids count mismatch", tamper: "diffids", wantErr: "2 diff ids for 1 layers"},
+		{name: "docker tagged", docker: true, repoTags: []string{"busybox:latest"}, want: "busybox:latest"},
+		{name: "docker without tags", docker: true, want: ""},
+		{name: "docker config digest mismatch", docker: true, tamper: "config", wantErr: "digest mismatch"},
+		{name: "docker layer digest mismatch", docker: true, tamper: "layer", wantErr: "digest mismatch"},
+		{name: "docker diff ids count mismatch", docker: true, tamper: "diffids", wantErr: "2 diff ids for 1 layers"},
+	}
+	for _, tt := range tests {
+		store, err := NewStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive := ociArchive(t, tt.tamper, tt.annotations)
+		if tt.docker {
+			archive = dockerArchive(t, tt.tamper, tt.repoTags)
+		}
+		images, err := store.Load(archive, tt.ref)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: Load() error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			if list, _ := store.List(); len(list) != 0 {
+				t.Errorf("%s: Load() created %d image(s) from a rejected archive", tt.name, len(list))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Load() error = %v", tt.name, err)
+			continue
+		}
+		if len(images) != 1 {
+			t.Errorf("%s: Load() loaded %d images, want 1", tt.name, len(images))
+			continue
+		}
+		got := ""
+		if images[0].Name != "" {
+			got = images[0].Name + ":" + images[0].Tag
+		}
+		if got != tt.want {
+			t.Errorf("%s: Load() named the image %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOCIReference(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		name        string
+		want        string
+	}{
+		{annotations: nil, name: "", want: ""},
+		{annotations: nil, name: "busybox:1.36", want: "busybox:1.36"},
+		{annotations: map[string]string{annotationRefName: "v1"}, name: "", want: ""},
+		{annotations: map[string]string{annotationRefName: "v1"}, name: "busybox", want: "busybox:v1"},
+		{annotations: map[string]string{annotationRefName: "v1"}, name: "localhost:5000/busybox:1.36", want: "localhost:5000/busybox:v1"},
+		{annotations: map[string]string{annotationRefName: "busybox:1.36"}, name: "other", want: "busybox:1.36"},
+		{annotations: map[string]string{annotationRefName: "library/busybox"}, name: "", want: "library/busybox"},
+		{
+			annotations: map[string]string{annotationRefName: "v1", annotationContainerdName: "docker.io/library/busybox:1.36"},
+			name:        "other",
+			want:        "docker.io/library/busybox:1.36",
+		},
+	}
+	for _, tt := range tests {
+		if got := ociReference(tt.annotations, tt.name); got != tt.want {
+			t.Errorf("ociReference(%v, %q) = %q, want %q", tt.annotations, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package image
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultRoot is the directory holding images and containers when none is given
+const DefaultRoot = "/var/lib/minidocker"
+
+// DefaultTag is used when a reference has no tag
+const DefaultTag = "latest"
+
+// ErrImageNotFound is returned when no image matches a reference
+var ErrImageNotFound = errors.New("image not found")
+
+/**
+ * @Description: Image is the metadata of an image in the store
+ * @param ID random hex id of the image
+ * @param Name repository name, e.g. busybox
+ * @param Tag tag, e.g. latest
+ * @param Created creation time
+ * @param Size size of the unpacked layers in bytes
+ * @param Layers diff ids of the layers, base layer first
+ * @param Config default run settings of the image, may be nil
+ */
+type Image struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Tag     string    `json:"tag"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+	Layers  []string  `json:"layers"`
+	Config  *Config   `json:"config,omitempty"`
+}
+
+// Reference returns name:tag of the image, or the short id of an untagged image
+func (img *Image) Reference() string {
+	if img.Name == "" {
+		return shortID(img.ID)
+	}
+	return img.Name + ":" + img.Tag
+}
+
+/**
+ * @Description: Store keeps images on disk, the layout under root is
+ *	images/repositories.json   name:tag -> image id
+ *	images/<id>/image.json     image metadata
+ *	layers/sha256/<hex>/       layers shared by the images, see RegisterLayer
+ */
+type Store struct {
+	root string
+}
+
+/**
+ * @Description: NewStore opens the image store, creating its directories if needed
+ * @param root root directory of minidocker, e.g. /var/lib/minidocker
+ * @return *Store, error
+ */
+func NewStore(root string) (*Store, error) {
+	s := &Store{root: root}
+	if err := os.MkdirAll(s.imagesDir(), 0700); err != nil {
+		log.Errorf("Failed to create image store %s: %v", s.imagesDir(), err)
+		return nil, err
+	}
+	if err := s.migrateRootfs(); err != nil {
+		log.Errorf("Failed to migrate image store %s: %v", s.imagesDir(), err)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Root returns the root directory of the store
+func (s *Store) Root() string {
+	return s.root
+}
+
+func (s *Store) imagesDir() string {
+	return filepath.Join(s.root, "images")
+}
+
+func (s *Store) imageDir(id string) string {
+	return filepath.Join(s.imagesDir(), id)
+}
+
+/**
+ * @Description: ParseReference splits name:tag, the tag defaults to latest
+ * @param ref e.g. busybox or busybox:1.36
+ * @return name, tag, error
+ */
+func ParseReference(ref string) (string, string, error) {
+	name, tag := ref, DefaultTag
+	// the tag follows the last colon, unless it belongs to a registry port, e.g. localhost:5000/busybox
+	if idx := strings.LastIndex(ref, ":"); idx != -1 && !strings.Contains(ref[idx+1:], "/") {
+		name, tag = ref[:idx], ref[idx+1:]
+	}
+	if name == "" || tag == "" || strings.ContainsAny(ref, " \t\n") {
+		return "", "", fmt.Errorf("invalid image reference [%s], must be name[:tag]", ref)
+	}
+	return name, tag, nil
+}
+
+/**
+ * @Description: Create adds an image made of registered layers to the store and tags
+ *	it as ref, an existing image with the same reference loses the tag
+ * @param ref name[:tag] of the new image, empty for an untagged image
+ * @param layers diff ids of the layers, base layer first
+ * @param config default run settings of the image, may be nil
+ * @return *Image, error
+ */
+func (s *Store) Create(ref string, layers []string, config *Config) (*Image, error) {
+	var name, tag string
+	if ref != "" {
+		var err error
+		if name, tag, err = ParseReference(ref); err != nil {
+			return nil, err
+		}
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("image %s has no layers", ref)
+	}
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	img := &Image{ID: id, Name: name, Tag: tag, Created: time.Now(), Layers: layers, Config: config}
+	for _, diffID := range layers {
+		size, err := dirSize(s.LayerDir(diffID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find layer %s: %v", diffID, err)
+		}
+		img.Size += size
+	}
+	if err := os.MkdirAll(s.imageDir(id), 0700); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(filepath.Join(s.imageDir(id), "image.json"), img); err != nil {
+		os.RemoveAll(s.imageDir(id))
+		return nil, err
+	}
+
+	if name != "" {
+		if err := s.Tag(img, img.Reference()); err != nil {
+			os.RemoveAll(s.imageDir(id))
+			return nil, err
+		}
+	}
+	log.Infof("Image %s created, id: %s", img.Reference(), shortID(id))
+	return img, nil
+}
+
+/**
+ * @Description: Tag points ref at the image, the image it pointed at before loses the tag
+ * @param img image to tag
+ * @param ref name[:tag]
+ * @return error
+ */
+func (s *Store) Tag(img *Image, ref string) error {
+	name, tag, err := ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	ref = name + ":" + tag
+	return s.updateRepositories(func(repos map[string]string) error {
+		if old, ok := repos[ref]; ok && old != img.ID {
+			log.Infof("Image %s moved from %s to %s", ref, shortID(old), shortID(img.ID))
+		}
+		repos[ref] = img.ID
+		return nil
+	})
+}
+
+/**
+ * @Description: Get finds an image by name[:tag] or by id prefix
+ * @param ref reference or id
+ * @return *Image, error
+ */
+func (s *Store) Get(ref string) (*Image, error) {
+	repos, err := s.readRepositories()
+	if err != nil {
+		return nil, err
+	}
+	if name, tag, err := ParseReference(ref); err == nil {
+		if id, ok := repos[name+":"+tag]; ok {
+			return s.load(id)
+		}
+	}
+
+	// fall back to an unambiguous id prefix
+	entries, err := os.ReadDir(s.imagesDir())
+	if err != nil {
+		return nil, err
+	}
+	var match string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), ref) {
+			if match != "" {
+				return nil, fmt.Errorf("image id prefix %s is ambiguous", ref)
+			}
+			match = entry.Name()
+		}
+	}
+	if match == "" {
+		return nil, fmt.Errorf("%w: %s", ErrImageNotFound, ref)
+	}
+	return s.load(match)
+}
+
+// List returns the images once per tag sorted by reference, untagged images last
+func (s *Store) List() ([]*Image, error) {
+	repos, err := s.readRepositories()
+	if err != nil {
+		return nil, err
+	}
+	var images []*Image
+	tagged := make(map[string]bool)
+	for ref, id := range repos {
+		img, err := s.load(id)
+		if err != nil {
+			log.Warnf("Failed to load image %s: %v", ref, err)
+			continue
+		}
+		// an image keeps its own name:tag, but the tag may have moved
+		img.Name, img.Tag, _ = ParseReference(ref)
+		images = append(images, img)
+		tagged[id] = true
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Reference() < images[j].Reference()
+	})
+
+	entries, err := os.ReadDir(s.imagesDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || tagged[entry.Name()] {
+			continue
+		}
+		img, err := s.load(entry.Name())
+		if err != nil {
+			log.Warnf("Failed to load image %s: %v", shortID(entry.Name()), err)
+			continue
+		}
+		img.Name, img.Tag = "", ""
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// Tags returns the references pointing at the image, sorted
+func (s *Store) Tags(img *Image) ([]string, error) {
+	repos, err := s.readRepositories()
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for ref, id := range repos {
+		if id == img.ID {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+/**
+ * @Description: Remove untags the image and deletes it once no tag refers to it
+ * @param img image to remove
+ * @return error
+ */
+func (s *Store) Remove(img *Image) error {
+	remaining, err := s.untag(img)
+	if err != nil || remaining > 0 {
+		return err
+	}
+
+	if err := os.RemoveAll(s.imageDir(img.ID)); err != nil {
+		log.Errorf("Failed to remove image dir %s: %v", s.imageDir(img.ID), err)
+		return err
+	}
+	log.Infof("Deleted image %s", shortID(img.ID))
+	return s.removeUnusedLayers()
+}
+
+// Untag removes the reference of the image, the image is kept even when no tag remains
+func (s *Store) Untag(img *Image) error {
+	_, err := s.untag(img)
+	return err
+}
+
+// untag removes the reference of the image and returns how many other tags it has
+func (s *Store) untag(img *Image) (int, error) {
+	remaining := 0
+	err := s.updateRepositories(func(repos map[string]string) error {
+		for ref, id := range repos {
+			if id != img.ID {
+				continue
+			}
+			if ref == img.Reference() {
+				delete(repos, ref)
+				log.Infof("Untagged %s", ref)
+			} else {
+				remaining++
+			}
+		}
+		return nil
+	})
+	return remaining, err
+}
+
+func (s *Store) load(id string) (*Image, error) {
+	img := &Image{}
+	if err := readJSON(filepath.Join(s.imageDir(id), "image.json"), img); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrImageNotFound, id)
+		}
+		return nil, err
+	}
+	return img, nil
+}
+
+func (s *Store) readRepositories() (map[string]string, error) {
+	repos := make(map[string]string)
+	err := readJSON(filepath.Join(s.imagesDir(), "repositories.json"), &repos)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// updateRepositories modifies repositories.json under an exclusive lock
+func (s *Store) updateRepositories(update func(repos map[string]string) error) error {
+	lock, err := os.OpenFile(filepath.Join(s.imagesDir(), ".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock image store: %v", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	repos, err := s.readRepositories()
+	if err != nil {
+		return err
+	}
+	if err := update(repos); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(s.imagesDir(), "repositories.json"), repos)
+}
+
+// randomID returns 32 random bytes in hex
+func randomID() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate id: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// shortID returns the first 12 characters of an id, like docker prints them
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// dirSize sums the size of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// writeJSON atomically replaces path with the json encoding of v
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,32 @@
+package image
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref     string
+		name    string
+		tag     string
+		wantErr bool
+	}{
+		{ref: "busybox", name: "busybox", tag: DefaultTag},
+		{ref: "busybox:1.36", name: "busybox", tag: "1.36"},
+		{ref: "library/busybox:musl", name: "library/busybox", tag: "musl"},
+		{ref: "localhost:5000/busybox", name: "localhost:5000/busybox", tag: DefaultTag},
+		{ref: "localhost:5000/busybox:v1", name: "localhost:5000/busybox", tag: "v1"},
+		{ref: "", wantErr: true},
+		{ref: ":v1", wantErr: true},
+		{ref: "busybox:", wantErr: true},
+		{ref: "busy box", wantErr: true},
+	}
+	for _, tt := range tests {
+		name, tag, err := ParseReference(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseReference(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if name != tt.name || tag != tt.tag {
+			t.Errorf("ParseReference(%q) = %q, %q, want %q, %q", tt.ref, name, tag, tt.name, tt.tag)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Magic numbers of the supported compression formats
+var (
+	gzipMagic  = []byte{0x1f, 0x8b, 0x08}
+	bzip2Magic = []byte{0x42, 0x5a, 0x68}
+	xzMagic    = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+/**
+ * @Description: DecompressStream detects the compression of a tarball from its
+ *	magic number and returns the uncompressed stream, plain tars pass through
+ * @param r compressed or plain tar stream
+ * @return io.ReadCloser, error
+ */
+func DecompressStream(r io.Reader) (io.ReadCloser, error) {
+	buf := bufio.NewReader(r)
+	// a short stream can not be compressed, let the tar reader report it
+	magic, _ := buf.Peek(len(xzMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip stream: %v", err)
+		}
+		return gz, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return io.NopCloser(bzip2.NewReader(buf)), nil
+	case bytes.HasPrefix(magic, xzMagic):
+		xzr, err := xz.NewReader(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read xz stream: %v", err)
+		}
+		return io.NopCloser(xzr), nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd stream: %v", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(buf), nil
+	}
+}
+
+/**
+ * @Description: Import creates a single layer image from a root filesystem tarball
+ * @param ref name[:tag] of the new image
+ * @param r tar stream, optionally gzip, bzip2, xz or zstd compressed
+ * @return *Image, error
+ */
+func (s *Store) Import(ref string, r io.Reader) (*Image, error) {
+	if _, _, err := ParseReference(ref); err != nil {
+		return nil, err
+	}
+	stream, err := DecompressStream(r)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	unlock, err := s.lockLayers(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	diffID, err := s.RegisterLayer(stream, "")
+	if err != nil {
+		return nil, err
+	}
+	return s.Create(ref, []string{diffID}, nil)
+}
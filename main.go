@@ -5,6 +5,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	cmd "minidocker/cmd"
+	image "minidocker/image"
 	"os"
 )
 
@@ -14,9 +15,27 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "minidocker"
 	app.Usage = usage
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "root",
+			Value: image.DefaultRoot,
+			Usage: "root directory of images and containers",
+		},
+	}
 	app.Commands = []cli.Command{
 		cmd.InitCommand,
 		cmd.RunCommand,
+		cmd.PsCommand,
+		cmd.CommitCommand,
+		cmd.ExportCommand,
+		cmd.DiffCommand,
+		cmd.CpCommand,
+		cmd.RmCommand,
+		cmd.ImportCommand,
+		cmd.LoadCommand,
+		cmd.ImagesCommand,
+		cmd.RmiCommand,
+		cmd.ImageCommand,
 	}
 
 	// set logger